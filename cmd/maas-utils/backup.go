@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+func backupIPs(client *maas.Client, path string) {
+	backup, skipped, err := maas.NewBackup(getNetworks(client), getIPs(client))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	for _, ip := range skipped {
+		logf("IP %q is not within any network, skipping.", ip.IP)
+	}
+	data, err := yaml.Marshal(backup)
+	if err != nil {
+		fatalf("cannot marshal YAML: %v", err)
+	}
+	if path == "" || path == "-" {
+		fmt.Print(string(data))
+	} else if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		fatalf("cannot write backup: %v", err)
+	}
+	logf("backed up %d user-reserved IPs.", len(backup.IPs))
+}
+
+// Results of restoring a backed up IP.
+const (
+	restoreRestored     = "restored"
+	restoreWouldRestore = "would-restore" // instead of restored, with --dry-run
+	restoreSkipped      = "skipped"
+	restoreConflict     = "conflict"
+	restoreFailed       = "failed"
+)
+
+// restoreResult is the outcome of restoring a single backed up IP.
+type restoreResult struct {
+	IP      string `json:"ip" yaml:"ip"`
+	Network string `json:"network" yaml:"network"`
+	Result  string `json:"result" yaml:"result"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func restoreIPs(client *maas.Client, path string) {
+	if path == "" {
+		fatalf("backup file is required but missing")
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		fatalf("cannot read backup: %v", err)
+	}
+	backup, err := maas.ParseBackup(data)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	networks := getNetworks(client)
+	existing := make(map[string]maas.StaticIP)
+	for _, ip := range getIPs(client) {
+		existing[ip.IP.String()] = ip
+	}
+
+	results := make([]restoreResult, len(backup.IPs))
+	counts := make(map[string]int)
+	for i, backupIP := range backup.IPs {
+		res := restoreIP(client, networks, existing, backupIP)
+		results[i] = res
+		counts[res.Result]++
+	}
+
+	rows := make([][]string, len(results))
+	for i, res := range results {
+		rows[i] = []string{res.IP, res.Network, res.Result, orDash(res.Error)}
+	}
+	if *format != "" {
+		printResults(results, []string{"IP", "NETWORK", "RESULT", "ERROR"}, rows, nil)
+	}
+	if dryRun {
+		logf("dry run: no IPs restored.")
+		return
+	}
+	logf("%d IPs restored; %d skipped; %d conflicts; %d failures",
+		counts[restoreRestored], counts[restoreSkipped], counts[restoreConflict], counts[restoreFailed],
+	)
+	if counts[restoreConflict] > 0 || counts[restoreFailed] > 0 {
+		os.Exit(1)
+	}
+}
+
+// restoreIP reserves the given backed up IP again, unless it is already
+// allocated.
+func restoreIP(client *maas.Client, networks map[string]maas.Network, existing map[string]maas.StaticIP, backupIP maas.BackupIP) restoreResult {
+	res := restoreResult{IP: backupIP.IP, Network: backupIP.Network}
+	ip := net.ParseIP(backupIP.IP)
+	if current, ok := existing[ip.String()]; ok {
+		if current.AllocType == maas.AllocUserReserved {
+			logf("IP %q is already reserved, skipping.", backupIP.IP)
+			res.Result = restoreSkipped
+			return res
+		}
+		res.Result = restoreConflict
+		res.Error = fmt.Sprintf("already allocated as %s", current.AllocType)
+		logf("IP %q is %s", backupIP.IP, res.Error)
+		return res
+	}
+	ipNet, err := backupIP.IPNet(networks)
+	if err != nil {
+		res.Result, res.Error = restoreFailed, err.Error()
+		logf("cannot restore IP %q: %v", backupIP.IP, err)
+		return res
+	}
+	if _, ok := networks[backupIP.Network]; !ok {
+		logf("network %q not found, using %s for IP %q", backupIP.Network, ipNet.String(), backupIP.IP)
+	}
+	if dryRun {
+		printDryRunCall(client.ReserveIPCall(ipNet, ip.String()))
+		res.Result = restoreWouldRestore
+		return res
+	}
+	if _, err := client.ReserveIP(ipNet, ip.String()); err != nil {
+		res.Result, res.Error = restoreFailed, err.Error()
+		if maas.StatusCode(err) == http.StatusConflict {
+			res.Result = restoreConflict
+		}
+		logf("cannot restore IP %q: %v", backupIP.IP, err)
+		return res
+	}
+	logf("IP %q restored on network %q.", backupIP.IP, backupIP.Network)
+	res.Result = restoreRestored
+	return res
+}
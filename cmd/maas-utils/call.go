@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/dimitern/go-tools/maas"
+)
+
+func callAction(client *maas.Client, args []string) {
+	if len(args) < 2 {
+		fatalf("resource and action to call not specified.")
+	}
+	apiDesc, _, err := getAPIDescription()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	call, err := apiDesc.NewActionCall(args[0], args[1], args[2:])
+	if err != nil {
+		fatalf("%v", err)
+	}
+	debugf("calling %s %s: %s", call.Handler.Name, call.Action.Name, client.Call(call))
+	if dryRun {
+		printDryRunCall(client.Call(call))
+		return
+	}
+
+	result, err := client.CallAction(call)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if result == nil {
+		logf("%s %s succeeded.", call.Handler.Name, call.Action.Name)
+		return
+	}
+	printMarshalled(result)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+func exportConfig(client *maas.Client) {
+	cfg, err := client.ExportConfig()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		fatalf("cannot marshal YAML: %v", err)
+	}
+	fmt.Print(string(data))
+}
+
+// planConfig returns the changes needed to make MAAS match the
+// configuration in the given file ("-" for stdin).
+func planConfig(client *maas.Client, path string) []maas.Change {
+	if path == "" {
+		fatalf("config file is required but missing")
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		fatalf("cannot read config: %v", err)
+	}
+	desired, err := maas.ParseConfig(data)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	current, err := client.ExportConfig()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return maas.PlanConfig(current, desired)
+}
+
+// printChanges prints the given changes in the format selected with
+// --format.
+func printChanges(changes []maas.Change) {
+	var created, updated int
+	rows := make([][]string, len(changes))
+	goStrings := make([]string, len(changes))
+	for i, change := range changes {
+		if change.Action == maas.ActionCreate {
+			created++
+		} else {
+			updated++
+		}
+		fields := make([]string, len(change.Diffs))
+		for j, diff := range change.Diffs {
+			fields[j] = diff.Field
+		}
+		rows[i] = []string{change.Action, change.Kind, orDash(change.ClusterID), change.Name, strings.Join(fields, ",")}
+		goStrings[i] = change.String()
+	}
+	printResults(changes, []string{"ACTION", "KIND", "CLUSTER", "NAME", "FIELDS"}, rows, goStrings)
+	logf("%d changes: %d to create, %d to update", len(changes), created, updated)
+}
+
+func planConfigChanges(client *maas.Client, path string) {
+	printChanges(planConfig(client, path))
+}
+
+func applyConfig(client *maas.Client, path string) {
+	if path == "-" && !assumeYes && !dryRun {
+		fatalf("--yes is required when reading the config from stdin")
+	}
+	changes := planConfig(client, path)
+	printChanges(changes)
+	if len(changes) == 0 {
+		return
+	}
+	if dryRun {
+		for _, change := range changes {
+			printDryRunCall(client.ApplyChangeCall(change))
+		}
+		logf("dry run: no changes applied.")
+		return
+	}
+	if !confirm("Apply %d changes?", len(changes)) {
+		fatalf("aborted, no changes applied.")
+	}
+	for i, change := range changes {
+		debugf("calling %s", client.ApplyChangeCall(change))
+		if err := client.ApplyChange(change); err != nil {
+			logf("%v", err)
+			logf("applied %d of %d changes", i, len(changes))
+			os.Exit(1)
+		}
+	}
+	logf("applied %d changes successfully.", len(changes))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+// readAPIDescription reads the JSON API description saved at path.
+func readAPIDescription(path string) *maas.APIDescription {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatalf("cannot read API description: %v", err)
+	}
+	apiDesc, _, err := maas.ParseAPIDescription(data)
+	if err != nil {
+		fatalf("cannot parse API description %q: %v", path, err)
+	}
+	return apiDesc
+}
+
+func describeDiff(oldPath, newPath string) {
+	if oldPath == "" || newPath == "" {
+		fatalf("old and new API description files not specified.")
+	}
+	oldDesc, newDesc := readAPIDescription(oldPath), readAPIDescription(newPath)
+	if oldDesc.Hash != "" && oldDesc.Hash == newDesc.Hash {
+		logf("API descriptions are identical (hash %s).", newDesc.Hash)
+		return
+	}
+	changes := maas.DiffAPIDescriptions(oldDesc, newDesc)
+
+	if *format != "" {
+		if changes == nil {
+			changes = []maas.APIChange{}
+		}
+		rows := make([][]string, len(changes))
+		for i, change := range changes {
+			path := change.Path
+			if change.Anon {
+				path += " (anonymous)"
+			}
+			rows[i] = []string{change.Type, path, orDash(change.Action), orDash(change.Param), orDash(change.Detail)}
+		}
+		columns := []string{"CHANGE", "PATH", "ACTION", "PARAM", "DETAIL"}
+		printResults(changes, columns, rows, nil)
+	} else {
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	}
+	if len(changes) > 0 {
+		logf("found %d differences (hash %s, was %s)", len(changes), newDesc.Hash, oldDesc.Hash)
+		os.Exit(1)
+	}
+	logf("no differences found, despite different hashes (%s, was %s)", newDesc.Hash, oldDesc.Hash)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+func freeIPs(client *maas.Client, netName string) {
+	if netName == "" {
+		fatalf("network name is required but missing")
+	}
+	if rangeMapWidth < 1 {
+		fatalf("invalid --width %d: expected at least 1", rangeMapWidth)
+	}
+	if showRangeMap && *format != "" {
+		fatalf("--map cannot be used with --format")
+	}
+	nw, ok := getNetworks(client)[netName]
+	if !ok {
+		fatalf("unknown network %q", netName)
+	}
+	nic, err := client.FindNIC(nw)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if !nic.HasStaticRange() {
+		fatalf(
+			"interface %q on node group %q matches network %q but has no static range",
+			nic.Name, nic.ClusterID, netName,
+		)
+	}
+	var allocated []net.IP
+	for _, ip := range getIPs(client) {
+		allocated = append(allocated, ip.IP.IP)
+	}
+	low, high := nic.StaticRangeLowIP.IP, nic.StaticRangeHighIP.IP
+	free, err := maas.FreeRanges(low, high, allocated)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	total := new(big.Int)
+	rows := make([][]string, len(free))
+	goStrings := make([]string, len(free))
+	for i, r := range free {
+		size := r.Size()
+		total.Add(total, size)
+		rows[i] = []string{r.Low.String(), r.High.String(), size.String()}
+		goStrings[i] = fmt.Sprintf("%s (%s free)", r, size)
+	}
+	logf("%s of %s addresses free in static range %s-%s of network %q:\n", total, maas.IPRange{Low: low, High: high}.Size(), low, high, netName)
+	if *format == "" {
+		// The default Go-syntax output is too verbose for intervals.
+		for _, s := range goStrings {
+			fmt.Println(s)
+		}
+	} else {
+		printResults(free, []string{"LOW", "HIGH", "SIZE"}, rows, goStrings)
+	}
+	if showRangeMap {
+		rangeMap, err := formatRangeMap(nic, free, rangeMapWidth)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("\n%s", rangeMap)
+	}
+}
+
+// formatRangeMap renders the static and DHCP ranges of nic as a line of at
+// most width characters, each standing for a block of addresses: "." if
+// all static addresses in it are free (i.e. within one of the free
+// ranges), "#" if none are, "+" if some are, "D" for DHCP addresses, and
+// " " for addresses in neither range.
+func formatRangeMap(nic maas.Interface, free []maas.IPRange, width int) (string, error) {
+	staticLow, staticHigh, err := maas.IPRangeToDecimal(nic.StaticRangeLowIP.IP, nic.StaticRangeHighIP.IP)
+	if err != nil {
+		return "", err
+	}
+	start, end := staticLow, staticHigh
+	var dhcpLow, dhcpHigh *big.Int
+	ipv6 := nic.StaticRangeLowIP.IP.To4() == nil
+	hasDHCP := !nic.DHCPRangeLowIP.IsEmpty() && !nic.DHCPRangeHighIP.IsEmpty() && (nic.DHCPRangeLowIP.IP.To4() == nil) == ipv6
+	if hasDHCP {
+		if dhcpLow, dhcpHigh, err = maas.IPRangeToDecimal(nic.DHCPRangeLowIP.IP, nic.DHCPRangeHighIP.IP); err != nil {
+			return "", err
+		}
+		if dhcpLow.Cmp(start) < 0 {
+			start = dhcpLow
+		}
+		if dhcpHigh.Cmp(end) > 0 {
+			end = dhcpHigh
+		}
+	}
+	freeDecimals := make([][2]*big.Int, len(free))
+	for i, r := range free {
+		if freeDecimals[i][0], freeDecimals[i][1], err = maas.IPRangeToDecimal(r.Low, r.High); err != nil {
+			return "", err
+		}
+	}
+
+	one := big.NewInt(1)
+	span := new(big.Int).Sub(end, start)
+	span.Add(span, one)
+	// Round up, so the map fits in width characters.
+	perCell := new(big.Int).Add(span, big.NewInt(int64(width-1)))
+	perCell.Div(perCell, big.NewInt(int64(width)))
+
+	var cells strings.Builder
+	for cellLow := new(big.Int).Set(start); cellLow.Cmp(end) <= 0; cellLow = new(big.Int).Add(cellLow, perCell) {
+		cellHigh := new(big.Int).Sub(new(big.Int).Add(cellLow, perCell), one)
+		if cellHigh.Cmp(end) > 0 {
+			cellHigh = end
+		}
+		static := maas.DecimalRangeOverlap(cellLow, cellHigh, staticLow, staticHigh)
+		switch {
+		case static.Sign() > 0:
+			freeInCell := new(big.Int)
+			for _, r := range freeDecimals {
+				freeInCell.Add(freeInCell, maas.DecimalRangeOverlap(cellLow, cellHigh, r[0], r[1]))
+			}
+			switch {
+			case freeInCell.Cmp(static) == 0:
+				cells.WriteByte('.')
+			case freeInCell.Sign() == 0:
+				cells.WriteByte('#')
+			default:
+				cells.WriteByte('+')
+			}
+		case hasDHCP && maas.DecimalRangeOverlap(cellLow, cellHigh, dhcpLow, dhcpHigh).Sign() > 0:
+			cells.WriteByte('D')
+		default:
+			cells.WriteByte(' ')
+		}
+	}
+
+	startIP, err := maas.DecimalToIP(start, ipv6)
+	if err != nil {
+		return "", err
+	}
+	endIP, err := maas.DecimalToIP(end, ipv6)
+	if err != nil {
+		return "", err
+	}
+	padding := cells.Len() + 2 - len(startIP.String()) - len(endIP.String())
+	if padding < 1 {
+		padding = 1
+	}
+	return fmt.Sprintf(
+		"%s%s%s\n[%s]\neach character is %s address(es): # allocated, + partially allocated, . free, D DHCP\n",
+		startIP, strings.Repeat(" ", padding), endIP, cells.String(), perCell,
+	), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+func lint(client *maas.Client) {
+	networks := getNetworks(client)
+	nics := getAllNICs(client)
+	issues := maas.Lint(networks, nics)
+
+	if *format != "" {
+		rows := make([][]string, len(issues))
+		for i, issue := range issues {
+			rows[i] = []string{issue.Check, orDash(issue.Network), orDash(issue.ClusterID), orDash(issue.Interface), issue.Message}
+		}
+		columns := []string{"CHECK", "NETWORK", "CLUSTER", "INTERFACE", "MESSAGE"}
+		printResults(issues, columns, rows, nil)
+	} else {
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+	}
+	if len(issues) > 0 {
+		logf("found %d problems in %d networks and %d interfaces", len(issues), len(networks), len(nics))
+		os.Exit(1)
+	}
+	logf("no problems found in %d networks and %d interfaces", len(networks), len(nics))
+}
@@ -1,43 +1,28 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"time"
 
-	"github.com/juju/gomaasapi"
+	"github.com/dimitern/go-tools/maas"
 )
 
-func getIPs(maasRoot *gomaasapi.MAASObject) []StaticIP {
-	ipaddrs := maasRoot.GetSubObject("ipaddresses")
-	result, err := ipaddrs.CallGet("", nil)
+func getIPs(client *maas.Client) []maas.StaticIP {
+	ips, err := client.GetIPs()
 	if err != nil {
-		fatalf("cannot get IPs: %v", err)
-	}
-
-	list, err := result.GetArray()
-	if err != nil {
-		fatalf("cannot list IPs: %v", err)
-	}
-	debugf("GetArray returned %d results", len(list))
-	ips := make([]StaticIP, len(list))
-	for i, ip := range list {
-		data, err := ip.MarshalJSON()
-		if err != nil {
-			fatalf("serializing to JSON failed: %v", err)
-		}
-		var staticIP StaticIP
-		if err := json.Unmarshal(data, &staticIP); err != nil {
-			fatalf("deserializing from JSON failed: %v", err)
-		}
-		ips[i] = staticIP
+		fatalf("%v", err)
 	}
+	debugf("got %d static IPs", len(ips))
 	return ips
 }
 
-func listIPs(maasRoot *gomaasapi.MAASObject) {
-	allIPs := getIPs(maasRoot)
+func listIPs(client *maas.Client) {
+	allIPs := getIPs(client)
 	logf("listing %d static IPs in MAAS:\n", len(allIPs))
-	for _, ip := range allIPs {
-		fmt.Println(ip.GoString(), "\n")
+	rows := make([][]string, len(allIPs))
+	goStrings := make([]string, len(allIPs))
+	for i, ip := range allIPs {
+		rows[i] = []string{ip.IP.String(), ip.AllocType.String(), ip.Created.UTC().Format(time.RFC3339)}
+		goStrings[i] = ip.GoString()
 	}
+	printResults(allIPs, []string{"IP", "ALLOC TYPE", "CREATED"}, rows, goStrings)
 }
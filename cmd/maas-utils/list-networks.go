@@ -1,47 +1,61 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
-	"github.com/juju/gomaasapi"
+	"github.com/dimitern/go-tools/maas"
 )
 
-func getNetworks(maasRoot *gomaasapi.MAASObject) map[string]Network {
-	nets := maasRoot.GetSubObject("networks")
-	result, err := nets.CallGet("", nil)
+func getNetworks(client *maas.Client) map[string]maas.Network {
+	networks, err := client.GetNetworks()
 	if err != nil {
-		fatalf("cannot get networks: %v", err)
+		fatalf("%v", err)
 	}
+	debugf("got %d networks", len(networks))
+	return networks
+}
 
-	list, err := result.GetArray()
-	if err != nil {
-		fatalf("cannot list networks: %v", err)
+// sortedNetworks returns the given networks sorted by name.
+func sortedNetworks(networks map[string]maas.Network) []maas.Network {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
 	}
-	debugf("GetArray returned %d results", len(list))
-	networks := make(map[string]Network, len(list))
-	for i, nw := range list {
-		obj, err := nw.GetMAASObject()
-		if err != nil {
-			fatalf("cannot get network #%d: %v", i, err)
-		}
-		data, err := obj.MarshalJSON()
-		if err != nil {
-			fatalf("serializing to JSON failed: %v", err)
-		}
-		var network Network
-		if err := json.Unmarshal(data, &network); err != nil {
-			fatalf("deserializing from JSON failed: %v", err)
-		}
-		networks[network.Name] = network
+	sort.Strings(names)
+	sorted := make([]maas.Network, len(names))
+	for i, name := range names {
+		sorted[i] = networks[name]
 	}
-	return networks
+	return sorted
 }
 
-func listNetworks(maasRoot *gomaasapi.MAASObject) {
-	nws := getNetworks(maasRoot)
+func listNetworks(client *maas.Client) {
+	nws := sortedNetworks(getNetworks(client))
 	logf("listing %d networks in MAAS:\n", len(nws))
-	for _, nw := range nws {
-		fmt.Println(nw.GoString(), "\n")
+	rows := make([][]string, len(nws))
+	goStrings := make([]string, len(nws))
+	for i, nw := range nws {
+		netmask, prefix := maas.FormatMask(nw.Netmask)
+		cidr := fmt.Sprintf("%s/%d", nw.IP, prefix)
+		if prefix < 0 {
+			cidr = fmt.Sprintf("%s/%s", nw.IP, netmask)
+		}
+		dnsServers := make([]string, len(nw.DNSServers))
+		for j, srv := range nw.DNSServers {
+			dnsServers[j] = srv.String()
+		}
+		rows[i] = []string{
+			nw.Name,
+			cidr,
+			fmt.Sprint(nw.VLANTag),
+			orDash(nw.Gateway.String()),
+			orDash(strings.Join(dnsServers, ",")),
+			orDash(nw.Description),
+		}
+		goStrings[i] = nw.GoString()
 	}
+	columns := []string{"NAME", "CIDR", "VLAN", "GATEWAY", "DNS SERVERS", "DESCRIPTION"}
+	printResults(nws, columns, rows, goStrings)
 }
@@ -1,77 +1,43 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-
-	"github.com/juju/gomaasapi"
+	"github.com/dimitern/go-tools/maas"
 )
 
-func getNodeGroupsUUIDs(maasRoot *gomaasapi.MAASObject) []string {
-	ng := maasRoot.GetSubObject("nodegroups")
-	result, err := ng.CallGet("list", nil)
-	if err != nil {
-		fatalf("cannot get node groups: %v", err)
-	}
-	nodeGroups, err := result.GetArray()
-	if err != nil {
-		fatalf("cannot list node groups: %v", err)
-	}
-	debugf("GetArray returned %d results", len(nodeGroups))
-	uuids := make([]string, len(nodeGroups))
-	for i, ngroup := range nodeGroups {
-		objMap, err := ngroup.GetMap()
-		if err != nil {
-			fatalf("cannot get node group #%d object map: %v", i, err)
-		}
-		uuid, ok := objMap["uuid"]
-		if !ok {
-			fatalf("cannot get node group #%d UUID from %v", i, objMap)
-		}
-		sUUID, err := uuid.GetString()
-		if err != nil {
-			fatalf("cannot get node group #%d UUID as string: %v", i, err)
-		}
-		uuids[i] = sUUID
-	}
-	return uuids
-}
-
-func getNICs(maasRoot *gomaasapi.MAASObject, uuidNG string) []Interface {
-	ngi := maasRoot.GetSubObject("nodegroups").GetSubObject(uuidNG).GetSubObject("interfaces")
-	result, err := ngi.CallGet("list", nil)
-	if err != nil {
-		fatalf("cannot get node group %q interfaces: %v", uuidNG, err)
-	}
-
-	list, err := result.GetArray()
+// getAllNICs returns the interfaces of all node groups.
+func getAllNICs(client *maas.Client) []maas.Interface {
+	debugf("getting the interfaces of all node groups")
+	nics, err := client.GetAllNICs()
 	if err != nil {
-		fatalf("cannot list node group %q interfaces: %v", uuidNG, err)
-	}
-	debugf("GetArray returned %d results", len(list))
-	nics := make([]Interface, len(list))
-	for i, nic := range list {
-		data, err := nic.MarshalJSON()
-		if err != nil {
-			fatalf("serializing to JSON failed: %v", err)
-		}
-		var iface Interface
-		if err := json.Unmarshal(data, &iface); err != nil {
-			fatalf("deserializing from JSON failed: %v", err)
-		}
-		iface.ClusterID = uuidNG
-		nics[i] = iface
+		fatalf("%v", err)
 	}
+	debugf("got %d interfaces", len(nics))
 	return nics
 }
 
-func listNICs(maasRoot *gomaasapi.MAASObject) {
-	debugf("getting all node groups UUIDs")
-	uuids := getNodeGroupsUUIDs(maasRoot)
-	logf("listing all NICs for node groups: %v\n", uuids)
-	for _, uuid := range uuids {
-		for _, nic := range getNICs(maasRoot, uuid) {
-			fmt.Println(nic.GoString(), "\n")
+func listNICs(client *maas.Client) {
+	allNICs := getAllNICs(client)
+	if allNICs == nil {
+		// Print [] rather than null with --format json.
+		allNICs = []maas.Interface{}
+	}
+	logf("listing %d NICs of all node groups\n", len(allNICs))
+	rows := make([][]string, len(allNICs))
+	goStrings := make([]string, len(allNICs))
+	for i, nic := range allNICs {
+		netmask, _ := maas.FormatMask(nic.Netmask)
+		rows[i] = []string{
+			nic.ClusterID,
+			nic.Name,
+			nic.Interface,
+			nic.RouterIP.String(),
+			orDash(netmask),
+			nic.Management.String(),
+			formatRange(nic.DHCPRangeLowIP, nic.DHCPRangeHighIP),
+			formatRange(nic.StaticRangeLowIP, nic.StaticRangeHighIP),
 		}
+		goStrings[i] = nic.GoString()
 	}
+	columns := []string{"CLUSTER", "NAME", "INTERFACE", "ROUTER IP", "NETMASK", "MANAGEMENT", "DHCP RANGE", "STATIC RANGE"}
+	printResults(allNICs, columns, rows, goStrings)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"flag"
 	"fmt"
@@ -8,20 +9,19 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
-	"github.com/juju/gomaasapi"
+	"github.com/dimitern/go-tools/maas"
 )
 
 const (
 	envServerURL = "MAAS_SERVER_URL"
 	envOAuthKey  = "MAAS_OAUTH_KEY"
 
-	maasAPIVersion = "1.0"
-
 	cmdUsage = `
 Usage:
 
-  maas-utils [-h] [-d] [-u <url>] [-o <oauth-key>] <command>
+  maas-utils [-h] [-d] [-u <url>] [-o <oauth-key>] [--format <format>] [--offline] <command>
 
 Accepted flags:
 
@@ -40,6 +40,19 @@ Accepted flags:
     is called. <oauth-key> is needed to authenticate with the MAAS API.
     Expected format: 'xxx:yyy:zzz'.
 
+  --format <format>
+    Output format of list commands: json, yaml, or tabular. When not
+    given, the detailed Go-syntax representation of each entry is printed.
+    "describe" supports openapi, markdown and html instead. Not supported by
+    reserve-ip, export, watch (see its --json flag), serve-metrics, and
+    backup-ips.
+
+  --offline
+    Use the API description cached by an earlier "describe" or "call" with
+    the same <url>, instead of getting it from the MAAS server. Descriptions
+    are cached under the user cache dir (e.g. ~/.cache/maas-utils/api).
+    "describe" and "call --dry-run" then need no MAAS server.
+
 Supported commands:
 
 %s
@@ -60,19 +73,313 @@ var (
 		false,
 		"enable verbose output for debugging",
 	)
+	format = flag.String("format",
+		"",
+		"output format of list commands (json, yaml, or tabular)",
+	)
+	offline = flag.Bool("offline",
+		false,
+		"use the cached API description, without contacting the MAAS server",
+	)
 )
 
 // Supported subcommands.
 var subcommands = map[string]string{
-	"list-ips":    "Lists all statically allocated IP addresses",
-	"release-ips": "Releases all statically allocated IP addresses",
+	"list-ips": "Lists all statically allocated IP addresses" + templateUsage,
+	"release-ips": `Releases statically allocated IP addresses, after asking for confirmation.
+    Arguments:
+      ip ... (optional, only release the given IPs)
+    Flags (all given filters must match; without any, all IPs are released):
+      --cidr <cidr> (optional, only release IPs within the given CIDR, e.g. 10.0.0.0/24)
+      --network <name> (optional, only release IPs within the given network)
+      --alloc-type <type> (optional, only release IPs with the given allocation type:
+        Auto, Sticky, UserReserved, or a number)
+      --older-than <duration> (optional, only release IPs created longer ago than
+        the given duration, e.g. 24h)
+      --yes (optional, do not ask for confirmation)
+      --dry-run (optional, print the POST calls to make, without making them)
+      --workers <n> (optional, number of concurrent releases, default 4)
+      --rate <n> (optional, maximum releases started per second, default unlimited)
+    With the global --format flag, a summary of the released and failed IPs
+    (with the MAAS error for each) is printed. Exits with status 1 if any
+    release failed.`,
 	"reserve-ip": `Reserve a static IP on a given network.
     Arguments:
       network name (required),
-      ip (optional, used if specified; if 'random' will pick a random IP within the static range)`,
-	"list-networks": "Lists all networks defined in MAAS",
-	"list-nics":     "Lists all interfaces of all node groups",
-	"describe":      "Get MAAS API description",
+      ip (optional, used if specified; otherwise MAAS picks one). Instead of an IP,
+        a free IP within the static range can be picked, based on existing allocations:
+        'first-free' (lowest), 'last-free' (highest), or 'random-free' (also 'random').
+    Flags:
+      --seed <seed> (optional, seed for 'random-free' for reproducible results;
+        the current time is used when not set)
+      --retries <count> (optional, how many times to pick another free IP, when MAAS
+        reports the picked one is already in use; default: 3)
+      --count <count> (optional, how many IPs to reserve; default: 1)
+      --contiguous (optional, reserve --count consecutive IPs within the static range,
+        starting with ip, if given; otherwise the block is picked like a free IP,
+        'first-free' by default)
+      --dry-run (optional, print the POST calls to make, without making them)
+    If any reservation fails, all IPs reserved so far are released.`,
+	"list-networks": "Lists all networks defined in MAAS" + templateUsage,
+	"list-nics":     "Lists all interfaces of all node groups" + templateUsage,
+	"describe": `Get MAAS API description
+    Flags:
+      --format openapi (optional, print it as an OpenAPI 3 JSON document,
+        with one path per handler path, and the actions sharing its method
+        merged into one operation, selected by the op query param, instead)
+      --format markdown|html (optional, print it as a reference grouped by
+        resource, with an anchor for each action, instead)
+      --generate-go (optional, print the source of a Go package providing a
+        typed client with one method per API action, instead)
+      --package <name> (optional, package name of the generated code;
+        default: maasapi)
+      --search <term> (optional, only describe actions with the term in their
+        name, op, doc, or param names and docs, or in their handler name or path;
+        case-insensitive, e.g. mac_address)
+      --method <method> (optional, only describe actions with the given HTTP
+        method, e.g. POST)
+      --resource <resource> (optional, only describe actions of the handler
+        with the given name, e.g. IPAddresses, or of handlers at or below the
+        given path, e.g. nodes)
+    The filters apply to every output format, with the matching actions
+    listed under their handler and its path. When any filter is given, -d
+    does not print the raw JSON, and the exit status is 1 when no actions
+    match.`,
+	"describe-diff": `Reports the differences between two API descriptions, as saved
+    with "maas-utils -d describe > file.json" (e.g. before and after a MAAS
+    upgrade): added and removed resources (keyed by handler path), actions
+    (keyed by name), params, and changed return codes. Exits with status 1
+    when differences are found. Identical hashes mean no differences.
+    Does not need a MAAS server.
+    Arguments:
+      old API description file (required)
+      new API description file (required)`,
+	"lint": `Checks networks and node group interfaces for consistency problems:
+    static ranges overlapping DHCP ranges, ranges outside the interface subnet,
+    network gateways outside the network subnet, networks without a matching
+    interface, matching interfaces which are unmanaged or lack a static range,
+    and VLAN tags used by more than one network. Exits with status 1 if any
+    problems are found.`,
+	"export": `Prints the configuration of all networks and node group interfaces
+    as YAML, as understood by "plan" and "apply".`,
+	"plan": `Shows the changes needed to make the networks and node group interfaces
+    match the given YAML configuration (see "export"). Networks and interfaces
+    missing from the configuration are left alone, and so are the fields
+    omitted from it.
+    Arguments:
+      config file (required, "-" for stdin)`,
+	"apply": `Makes the changes shown by "plan", after asking for confirmation.
+    Arguments:
+      config file (required, "-" for stdin)
+    Flags:
+      --yes (optional, do not ask for confirmation)
+      --dry-run (optional, print the API calls to make, without making them)
+    Stops at the first failed change, exiting with status 1.`,
+	"backup-ips": `Saves all user-reserved static IPs, with the network each was reserved
+    on, as YAML, so "restore-ips" can reserve them again.
+    Arguments:
+      backup file (optional, "-" or none for stdout)`,
+	"restore-ips": `Reserves again the static IPs saved by "backup-ips". IPs which are already
+    reserved are skipped; IPs allocated otherwise, or which MAAS reports are
+    in use, are reported as conflicts. Exits with status 1 on any conflicts
+    or failures.
+    Arguments:
+      backup file (required, "-" for stdin)
+    Flags:
+      --dry-run (optional, print the POST calls to make, without making them)
+    With the global --format flag, the result for each IP is printed
+    ("would-restore" instead of "restored" with --dry-run).`,
+	"watch": `Polls the static IPs and networks, printing an event for each one added
+    or removed, as "<time> <type> <details>", where type is one of ip-added,
+    ip-removed, network-added, or network-removed.
+    Flags:
+      --interval <duration> (optional, how often to poll; default: 5s)
+      --json (optional, print each event as a line of JSON)
+      --polls <n> (optional, stop after polling n times; default: never)`,
+	"call": `Calls any action of the MAAS API, as listed by "describe", and prints
+    the result as JSON (or YAML with --format yaml).
+    Arguments:
+      resource (required, handler name, e.g. IPAddresses, or path relative
+        to the API prefix, e.g. nodegroups/<uuid>/interfaces/)
+      action (required, action name or op, e.g. read or reserve)
+      key=value... (optional, params of the action, or of the handler path,
+        e.g. uuid=<uuid>; repeat a key or separate values with commas to
+        pass a list)
+    Param names are checked against the documented params of the action,
+    and values are converted to their documented type.
+    Flags:
+      --dry-run (optional, print the call to make, without making it)`,
+	"serve-metrics": `Serves Prometheus metrics about the static IP pool of each network on
+    /metrics: the static range size of the matching node group interface,
+    the free addresses left in it, the number of allocated IPs within the
+    network by allocation type, and the DHCP range size. The metrics are
+    refreshed from MAAS in the background; failed refreshes are counted in
+    maas_scrape_errors_total.
+    Flags:
+      --listen <address> (optional, address to listen on; default: :9550)
+      --interval <duration> (optional, how often to refresh; default: 1m)`,
+	"free-ips": `Lists the free intervals of the static range of a network.
+    Arguments:
+      network name (required)
+    Flags:
+      --map (optional, also draw an ASCII map of the static and DHCP ranges,
+        showing allocated and free blocks)
+      --width <n> (optional, maximum width of the map; default: 64)`,
+	"whois-ip": `Shows how an IP address is used: the network containing it, the node
+    group interface serving it, whether it is within the static or DHCP range
+    of the interface, and whether it is allocated (with its allocation type
+    and creation time).
+    Arguments:
+      ip (required)`,
+	"usage": `Reports the usage of the static IP pool of each network: the static range
+    size of the matching node group interface, the number of allocated IPs
+    within the network by allocation type, the free addresses left in the
+    static range, the DHCP range size, and the static range utilization.
+    Arguments:
+      network name ... (optional, only report the given networks)
+    Flags:
+      --max-utilization <percent> (optional, exit with status 1 if any static
+        range is at least this utilized, e.g. 90)
+      --min-free <count> (optional, exit with status 1 if any static range has
+        fewer free addresses left)` + strings.TrimPrefix(templateUsage, "\n    Flags:"),
+}
+
+const templateUsage = `
+    Flags:
+      --template <template> (optional, Go text/template to render each entry with;
+        see https://golang.org/pkg/text/template/ and the helper functions below)
+          cidr <network-or-interface>: "10.20.0.0/24"
+          netmask <mask>: "255.255.255.0"
+          prefix <mask>: 24
+          ipRange <low> <high>: "10.20.0.10-10.20.0.99" ("" if either is empty)
+          rangeSize <low> <high>: number of addresses between low and high, inclusive
+          inRange <ip> <low> <high>: true if low <= ip <= high`
+
+// Flags accepted by some subcommands, after the command name.
+var (
+	templateText      string
+	randomSeed        int64
+	reserveRetries    int
+	reserveCount      int
+	reserveContiguous bool
+	releaseCIDR       string
+	releaseNetwork    string
+	releaseAllocType  string
+	releaseOlderThan  time.Duration
+	releaseWorkers    int
+	releaseRate       float64
+	assumeYes         bool
+	dryRun            bool
+	maxUtilization    float64
+	minFree           int64
+	showRangeMap      bool
+	rangeMapWidth     int
+	watchInterval     time.Duration
+	watchJSON         bool
+	watchPolls        int
+	metricsListen     string
+	metricsInterval   time.Duration
+	generateGo        bool
+	generatePackage   string
+	describeFilter    maas.APIFilter
+)
+
+// commandFlags returns the flags accepted by the given subcommand.
+func commandFlags(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	switch cmd {
+	case "list-ips", "list-networks", "list-nics":
+		fs.StringVar(&templateText, "template", "", "Go text/template to render each entry with")
+	case "reserve-ip":
+		fs.Int64Var(&randomSeed, "seed", 0, "seed for picking a random free IP (default: current time)")
+		fs.IntVar(&reserveRetries, "retries", 3, "how many times to retry with another free IP on conflicts")
+		fs.IntVar(&reserveCount, "count", 1, "how many IPs to reserve")
+		fs.BoolVar(&reserveContiguous, "contiguous", false, "reserve a block of --count consecutive IPs")
+		fs.BoolVar(&dryRun, "dry-run", false, "print the POST calls to make, without making them")
+	case "release-ips":
+		fs.StringVar(&releaseCIDR, "cidr", "", "only release IPs within the given CIDR")
+		fs.StringVar(&releaseNetwork, "network", "", "only release IPs within the given network")
+		fs.StringVar(&releaseAllocType, "alloc-type", "", "only release IPs with the given allocation type")
+		fs.DurationVar(&releaseOlderThan, "older-than", 0, "only release IPs created longer ago than the given duration")
+		fs.BoolVar(&assumeYes, "yes", false, "do not ask for confirmation")
+		fs.BoolVar(&dryRun, "dry-run", false, "print the POST calls to make, without making them")
+		fs.IntVar(&releaseWorkers, "workers", 4, "number of concurrent releases")
+		fs.Float64Var(&releaseRate, "rate", 0, "maximum releases started per second (0 means unlimited)")
+	case "watch":
+		fs.DurationVar(&watchInterval, "interval", 5*time.Second, "how often to poll")
+		fs.BoolVar(&watchJSON, "json", false, "print each event as a line of JSON")
+		fs.IntVar(&watchPolls, "polls", 0, "stop after polling n times (0 means never)")
+	case "describe":
+		fs.StringVar(format, "format", *format, "output format of the API description")
+		fs.BoolVar(&generateGo, "generate-go", false, "print the source of a typed Go client")
+		fs.StringVar(&generatePackage, "package", "maasapi", "package name of the generated code")
+		fs.StringVar(&describeFilter.Search, "search", "", "only describe actions containing the given term")
+		fs.StringVar(&describeFilter.Method, "method", "", "only describe actions with the given HTTP method")
+		fs.StringVar(&describeFilter.Resource, "resource", "", "only describe actions of the given resource")
+	case "serve-metrics":
+		fs.StringVar(&metricsListen, "listen", ":9550", "address to listen on")
+		fs.DurationVar(&metricsInterval, "interval", time.Minute, "how often to refresh the metrics")
+	case "restore-ips":
+		fs.BoolVar(&dryRun, "dry-run", false, "print the POST calls to make, without making them")
+	case "call":
+		fs.BoolVar(&dryRun, "dry-run", false, "print the call to make, without making it")
+	case "apply":
+		fs.BoolVar(&assumeYes, "yes", false, "do not ask for confirmation")
+		fs.BoolVar(&dryRun, "dry-run", false, "print the API calls to make, without making them")
+	case "free-ips":
+		fs.BoolVar(&showRangeMap, "map", false, "draw an ASCII map of the static and DHCP ranges")
+		fs.IntVar(&rangeMapWidth, "width", 64, "maximum width of the map")
+	case "usage":
+		fs.StringVar(&templateText, "template", "", "Go text/template to render each entry with")
+		fs.Float64Var(&maxUtilization, "max-utilization", 0, "exit with status 1 if any static range is at least this utilized (percent)")
+		fs.Int64Var(&minFree, "min-free", 0, "exit with status 1 if any static range has fewer free addresses left")
+	}
+	return fs
+}
+
+// maxArgs holds the maximum number of positional arguments each subcommand
+// accepts (0 if not listed, -1 for any number).
+var maxArgs = map[string]int{
+	"reserve-ip":    2,
+	"release-ips":   -1,
+	"usage":         -1,
+	"whois-ip":      1,
+	"free-ips":      1,
+	"plan":          1,
+	"apply":         1,
+	"backup-ips":    1,
+	"restore-ips":   1,
+	"call":          -1,
+	"describe-diff": 2,
+}
+
+// parseCommandArgs parses the flags of the given subcommand, which may be
+// interspersed with positional arguments, and returns the latter.
+func parseCommandArgs(cmd string, args []string) []string {
+	fs := commandFlags(cmd)
+	fs.SetOutput(bytes.NewBuffer(nil))
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err != flag.ErrHelp {
+				logf("%s: %v", cmd, err)
+			}
+			fmt.Fprintf(os.Stderr, "\nUsage of %s:\n", cmd)
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+			os.Exit(2)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if max := maxArgs[cmd]; max >= 0 && len(positional) > max {
+		flag.Usage()
+	}
+	return positional
 }
 
 func main() {
@@ -110,23 +417,75 @@ func main() {
 		flag.Usage()
 	}
 
-	if flag.NArg() != 1 && flag.Arg(0) != "reserve-ip" {
-		// Only reserve-ip takes extra arguments.
-		flag.Usage()
+	args := parseCommandArgs(flag.Arg(0), flag.Args()[1:])
+
+	switch flag.Arg(0) {
+	case "describe":
+		checkFormat(formatOpenAPI, formatMarkdown, formatHTML)
+	case "call":
+		checkFormat(formatJSON, formatYAML)
+	case "reserve-ip", "export", "watch", "serve-metrics", "backup-ips":
+		checkFormat()
+	default:
+		checkFormat(formatJSON, formatYAML, formatTabular)
+	}
+	if *offline && flag.Arg(0) != "describe" && flag.Arg(0) != "call" {
+		fatalf("--offline is only supported by describe and call.")
 	}
+	parseTemplate()
+	seedRandom()
 
+	if flag.Arg(0) == "describe-diff" {
+		args = append(args, "", "")
+		describeDiff(args[0], args[1])
+		return
+	}
 	if *serverURL == "" {
 		fatalf("MAAS server URL not specified.")
 	}
 	if flag.Arg(0) == "describe" {
-		apiDesc, rawJSON, err := GetAPIDescription(*serverURL)
+		apiDesc, rawJSON, err := getAPIDescription()
 		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(3)
 		}
-		if *debug {
+		if !describeFilter.IsEmpty() {
+			apiDesc = apiDesc.Filter(describeFilter)
+			if len(apiDesc.Resources) == 0 {
+				logf("no actions match.")
+				os.Exit(1)
+			}
+			rawJSON = ""
+		}
+		switch {
+		case generateGo:
+			src, err := apiDesc.GenerateGo(generatePackage)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(3)
+			}
+			fmt.Print(string(src))
+		case *format == formatOpenAPI:
+			data, err := apiDesc.OpenAPI()
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(3)
+			}
+			fmt.Println(string(data))
+		case *format == formatMarkdown || *format == formatHTML:
+			render := apiDesc.Markdown
+			if *format == formatHTML {
+				render = apiDesc.HTML
+			}
+			ref, err := render()
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(3)
+			}
+			fmt.Print(ref)
+		case *debug && rawJSON != "":
 			fmt.Println(rawJSON)
-		} else {
+		default:
 			fmt.Println(apiDesc.Format())
 		}
 		os.Exit(0)
@@ -135,22 +494,73 @@ func main() {
 		fatalf("MAAS OAuth key not specified.")
 	}
 
-	_, maasRoot := connect()
+	client := connect()
 
 	switch flag.Arg(0) {
 	case "list-ips":
-		listIPs(maasRoot)
+		listIPs(client)
 	case "release-ips":
-		releaseIPs(maasRoot)
+		releaseIPs(client, args)
 	case "reserve-ip":
-		reserveIP(maasRoot, flag.Arg(1), flag.Arg(2))
+		args = append(args, "", "")
+		reserveIP(client, args[0], args[1])
 	case "list-networks":
-		listNetworks(maasRoot)
+		listNetworks(client)
 	case "list-nics":
-		listNICs(maasRoot)
+		listNICs(client)
+	case "lint":
+		lint(client)
+	case "usage":
+		reportUsage(client, args)
+	case "whois-ip":
+		args = append(args, "")
+		whoisIP(client, args[0])
+	case "free-ips":
+		args = append(args, "")
+		freeIPs(client, args[0])
+	case "export":
+		exportConfig(client)
+	case "plan":
+		args = append(args, "")
+		planConfigChanges(client, args[0])
+	case "apply":
+		args = append(args, "")
+		applyConfig(client, args[0])
+	case "watch":
+		watch(client)
+	case "serve-metrics":
+		serveMetrics(client)
+	case "call":
+		callAction(client, args)
+	case "backup-ips":
+		args = append(args, "")
+		backupIPs(client, args[0])
+	case "restore-ips":
+		args = append(args, "")
+		restoreIPs(client, args[0])
 	}
 }
 
+// getAPIDescription returns the API description of the MAAS server and its
+// indented raw JSON, updating the cache. With --offline, the cached
+// description is returned instead.
+func getAPIDescription() (*maas.APIDescription, string, error) {
+	dir, err := maas.DefaultAPICacheDir()
+	if err != nil {
+		if *offline {
+			return nil, "", err
+		}
+		debugf("not caching API description: %v", err)
+		return maas.GetAPIDescription(*serverURL)
+	}
+	cache := maas.NewAPICache(dir)
+	if *offline {
+		debugf("using API description cached in %q", dir)
+		return cache.CachedAPIDescription(*serverURL)
+	}
+	return cache.GetAPIDescription(*serverURL)
+}
+
 func debugf(f string, a ...interface{}) {
 	if !*debug {
 		return
@@ -169,11 +579,26 @@ func fatalf(f string, a ...interface{}) {
 	os.Exit(2)
 }
 
-func connect() (*gomaasapi.Client, *gomaasapi.MAASObject) {
-	client, err := gomaasapi.NewAuthenticatedClient(*serverURL, *oauthKey, maasAPIVersion)
+// confirm asks the user the given question, and returns whether the answer
+// was yes. With --yes, it returns true without asking.
+func confirm(f string, a ...interface{}) bool {
+	if assumeYes {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", fmt.Sprintf(f, a...))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func connect() *maas.Client {
+	client, err := maas.NewClient(*serverURL, *oauthKey)
 	if err != nil {
-		fatalf("cannot connect: %v", err)
+		fatalf("%v", err)
 	}
 	debugf("connected to %q", *serverURL)
-	return client, gomaasapi.NewMAAS(*client)
+	return client
 }
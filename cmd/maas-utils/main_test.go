@@ -0,0 +1,1520 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitern/go-tools/maas"
+	"github.com/dimitern/go-tools/maas/maasapi"
+	"github.com/dimitern/go-tools/maas/maastest"
+)
+
+// envRunMain tells the test binary to run main() instead of the tests, so
+// each subcommand can be run end-to-end in a separate process.
+const envRunMain = "MAAS_UTILS_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envRunMain) != "" {
+		main()
+		os.Exit(0)
+	}
+	// Keep the API descriptions cached by the subcommands out of the user
+	// cache dir.
+	cacheDir, err := ioutil.TempDir("", "maas-utils-cache-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	os.Setenv("XDG_CACHE_HOME", cacheDir)
+	code := m.Run()
+	os.RemoveAll(cacheDir)
+	os.Exit(code)
+}
+
+type result struct {
+	stdout, stderr string
+	code           int
+}
+
+// run runs maas-utils with the given arguments against srv.
+func run(t *testing.T, srv *maastest.Server, args ...string) result {
+	t.Helper()
+	return runWithInput(t, srv, "", args...)
+}
+
+// runWithInput runs maas-utils with the given arguments against srv, and
+// input as its standard input.
+func runWithInput(t *testing.T, srv *maastest.Server, input string, args ...string) result {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		envRunMain+"=1",
+		envServerURL+"="+srv.URL,
+		envOAuthKey+"=consumer:token:secret",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	res := result{stdout: stdout.String(), stderr: stderr.String()}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		res.code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("cannot run %v: %v", args, err)
+	}
+	return res
+}
+
+func newServer(t *testing.T) *maastest.Server {
+	srv := maastest.NewServer()
+	t.Cleanup(srv.Close)
+
+	srv.AddNetwork(maastest.Network{
+		Name:       "maas-eth0",
+		IP:         "10.20.0.0",
+		Netmask:    "255.255.255.0",
+		Gateway:    "10.20.0.1",
+		DNSServers: "10.20.0.2",
+	})
+	srv.AddNetwork(maastest.Network{
+		Name:    "vlan-42",
+		IP:      "10.42.0.0",
+		Netmask: "255.255.255.0",
+		VLANTag: 42,
+	})
+	srv.AddNodeGroup("ng-1",
+		maastest.NodeGroupInterface{
+			Name:              "eth0",
+			Interface:         "eth0",
+			IP:                "10.20.0.2",
+			BroadcastIP:       "10.20.0.255",
+			SubnetMask:        "255.255.255.0",
+			IPRangeLow:        "10.20.0.10",
+			IPRangeHigh:       "10.20.0.99",
+			StaticIPRangeLow:  "10.20.0.100",
+			StaticIPRangeHigh: "10.20.0.110",
+			Management:        2,
+		},
+		maastest.NodeGroupInterface{
+			Name:       "eth0.42",
+			Interface:  "eth0.42",
+			IP:         "10.42.0.2",
+			SubnetMask: "255.255.255.0",
+			Management: 1,
+		},
+	)
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.100", AllocType: maastest.AllocUserReserved})
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.105", AllocType: 0})
+	return srv
+}
+
+func serverIPs(srv *maastest.Server) []string {
+	var ips []string
+	for _, ip := range srv.IPs() {
+		ips = append(ips, ip.IP)
+	}
+	return ips
+}
+
+func assertContains(t *testing.T, output string, expected ...string) {
+	t.Helper()
+	for _, exp := range expected {
+		if !strings.Contains(output, exp) {
+			t.Errorf("expected output to contain %q, got:\n%s", exp, output)
+		}
+	}
+}
+
+func assertCode(t *testing.T, res result, expected int) {
+	t.Helper()
+	if res.code != expected {
+		t.Fatalf("expected exit code %d, got %d\nstdout:\n%s\nstderr:\n%s", expected, res.code, res.stdout, res.stderr)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	res := run(t, newServer(t), "foo")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "unknown command: foo")
+}
+
+func TestListIPs(t *testing.T) {
+	res := run(t, newServer(t), "list-ips")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "listing 2 static IPs")
+	assertContains(t, res.stdout, `IP: "10.20.0.100"`, `IP: "10.20.0.105"`, `AllocType: "UserReserved"`, `AllocType: "Auto"`)
+}
+
+func TestListNetworks(t *testing.T) {
+	res := run(t, newServer(t), "list-networks")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "listing 2 networks")
+	assertContains(t, res.stdout, `Name: "maas-eth0"`, `Gateway: "10.20.0.1"`, `Name: "vlan-42"`, "VLANTag: 42")
+}
+
+func TestListNICs(t *testing.T) {
+	res := run(t, newServer(t), "list-nics")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		`ClusterID: "ng-1", Name: "eth0"`,
+		`StaticRangeLowIP: "10.20.0.100", StaticRangeHighIP: "10.20.0.110"`,
+		`Name: "eth0.42"`, `Management: "ManageDHCPOnly"`,
+	)
+}
+
+func TestReserveIPExplicit(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "reserve-ip", "maas-eth0", "10.20.0.107")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `allocated IP address "10.20.0.107" on network "maas-eth0" successfully`)
+	assertContains(t, strings.Join(serverIPs(srv), " "), "10.20.0.107")
+}
+
+func TestReserveIPPickedByMAAS(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "reserve-ip", "maas-eth0")
+	assertCode(t, res, 0)
+	// 10.20.0.100 is taken already.
+	assertContains(t, res.stderr, `allocated IP address "10.20.0.101"`)
+}
+
+func TestReserveIPFirstMatchingNodeGroup(t *testing.T) {
+	srv := newServer(t)
+	// Both MAAS and maas-utils use the first matching interface.
+	srv.AddNodeGroup("ng-2", maastest.NodeGroupInterface{
+		Name:              "eth1",
+		Interface:         "eth1",
+		IP:                "10.20.0.3",
+		SubnetMask:        "255.255.255.0",
+		StaticIPRangeLow:  "10.20.0.200",
+		StaticIPRangeHigh: "10.20.0.210",
+	})
+	res := run(t, srv, "reserve-ip", "maas-eth0", "last-free")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `allocated IP address "10.20.0.110"`)
+}
+
+func TestReserveIPFreeStrategies(t *testing.T) {
+	srv := newServer(t)
+	// Allocated, but not listed by MAAS.
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.101", AllocType: maastest.AllocUserReserved, Hidden: true})
+
+	res := run(t, srv, "reserve-ip", "maas-eth0", "first-free")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr,
+		`IP address "10.20.0.101" is already in use, retrying (1 of 3)`,
+		`allocated IP address "10.20.0.102" on network "maas-eth0"`,
+	)
+
+	res = run(t, srv, "reserve-ip", "maas-eth0", "last-free")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `allocated IP address "10.20.0.110"`)
+
+	res = run(t, srv, "reserve-ip", "maas-eth0", "first-free", "--retries", "0")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "409 Conflict (The IP address 10.20.0.101 is already in use.")
+}
+
+func TestReserveIPRandom(t *testing.T) {
+	reserveRandom := func(seed string) string {
+		srv := newServer(t)
+		res := run(t, srv, "reserve-ip", "maas-eth0", "random", "--seed", seed)
+		assertCode(t, res, 0)
+		for _, ip := range serverIPs(srv) {
+			if ip != "10.20.0.100" && ip != "10.20.0.105" {
+				return ip
+			}
+		}
+		t.Fatalf("no new IP reserved")
+		return ""
+	}
+	first := reserveRandom("42")
+	if again := reserveRandom("42"); again != first {
+		t.Fatalf("expected the same IP %q with the same seed, got %q", first, again)
+	}
+	_, static, _ := net.ParseCIDR("10.20.0.96/28")
+	if !static.Contains(net.ParseIP(first)) {
+		t.Fatalf("unexpected IP %q outside of static range", first)
+	}
+}
+
+func TestReserveIPLastAddressInRange(t *testing.T) {
+	srv := newServer(t)
+	// Leave only the high bound free.
+	for i := 101; i < 110; i++ {
+		if i != 105 {
+			srv.AddIP(maastest.StaticIP{IP: fmt.Sprintf("10.20.0.%d", i), AllocType: maastest.AllocUserReserved})
+		}
+	}
+	res := run(t, srv, "reserve-ip", "maas-eth0", "random-free")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `allocated IP address "10.20.0.110"`)
+
+	res = run(t, srv, "reserve-ip", "maas-eth0", "random-free")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "no free addresses in range 10.20.0.100-10.20.0.110")
+}
+
+func TestReserveIPErrors(t *testing.T) {
+	srv := newServer(t)
+	for _, test := range []struct {
+		args   []string
+		stderr string
+	}{{
+		args:   []string{"reserve-ip"},
+		stderr: "network name is required but missing",
+	}, {
+		args:   []string{"reserve-ip", "missing"},
+		stderr: `unknown network "missing"`,
+	}, {
+		args:   []string{"reserve-ip", "maas-eth0", "10.99.0.1"},
+		stderr: `IP address "10.99.0.1" not within network "maas-eth0" range "10.20.0.0/24"`,
+	}, {
+		args:   []string{"reserve-ip", "maas-eth0", "10.20.0.100"},
+		stderr: "409 Conflict",
+	}, {
+		args:   []string{"reserve-ip", "vlan-42"},
+		stderr: `interface "eth0.42" on node group "ng-1" matches network "vlan-42" but has no static range`,
+	}} {
+		res := run(t, srv, test.args...)
+		assertCode(t, res, 2)
+		assertContains(t, res.stderr, test.stderr)
+	}
+	if ips := serverIPs(srv); len(ips) != 2 {
+		t.Fatalf("expected no new IPs, got %v", ips)
+	}
+}
+
+func TestReleaseIPs(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "release-ips", "--yes")
+	assertCode(t, res, 1)
+	assertContains(t, res.stderr, `IP "10.20.0.100" released.`, "1 IPs successfully released; 1 failures")
+	// Only user-reserved addresses can be released.
+	if ips := serverIPs(srv); len(ips) != 1 || ips[0] != "10.20.0.105" {
+		t.Fatalf("unexpected IPs after release: %v", ips)
+	}
+}
+
+func TestReleaseIPsConfirmation(t *testing.T) {
+	srv := newServer(t)
+	res := runWithInput(t, srv, "n\n", "release-ips")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "2 of 2 allocated IPs will be released:", "Release 2 IPs? [y/N]", "aborted, no IPs released.")
+	if ips := serverIPs(srv); len(ips) != 2 {
+		t.Fatalf("expected no IPs released, got %v", ips)
+	}
+
+	res = runWithInput(t, srv, "y\n", "release-ips", "10.20.0.100")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "1 of 2 allocated IPs will be released:", "1 IPs successfully released; 0 failures")
+}
+
+func TestReleaseIPsFilters(t *testing.T) {
+	srv := newServer(t)
+	old := time.Now().Add(-48 * time.Hour).UTC().Format("2006-01-02T15:04:05.000000")
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.106", AllocType: maastest.AllocUserReserved, Created: old})
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.107", AllocType: maastest.AllocUserReserved})
+	srv.AddIP(maastest.StaticIP{IP: "10.42.0.10", AllocType: maastest.AllocUserReserved, Created: old})
+
+	for i, test := range []struct {
+		args     []string
+		released []string
+	}{{
+		args:     []string{"--older-than", "24h", "--network", "maas-eth0"},
+		released: []string{"10.20.0.106"},
+	}, {
+		args:     []string{"--cidr", "10.42.0.0/16"},
+		released: []string{"10.42.0.10"},
+	}, {
+		args:     []string{"--alloc-type", "userreserved", "10.20.0.105", "10.20.0.107"},
+		released: []string{"10.20.0.107"},
+	}, {
+		args:     []string{"--alloc-type", "4"},
+		released: []string{"10.20.0.100"},
+	}} {
+		res := run(t, srv, append([]string{"release-ips", "--yes"}, test.args...)...)
+		assertCode(t, res, 0)
+		for _, ip := range test.released {
+			assertContains(t, res.stderr, fmt.Sprintf("IP %q released.", ip))
+		}
+		assertContains(t, res.stderr, fmt.Sprintf("%d IPs successfully released; 0 failures", len(test.released)))
+		if strings.Count(res.stderr, "released.") != len(test.released) {
+			t.Errorf("test %d: expected only %v released, got:\n%s", i, test.released, res.stderr)
+		}
+	}
+	if ips := serverIPs(srv); strings.Join(ips, " ") != "10.20.0.105" {
+		t.Fatalf("unexpected IPs left: %v", ips)
+	}
+
+	res := run(t, srv, "release-ips", "--alloc-type", "foo")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, `invalid allocation type "foo"`)
+}
+
+func TestDescribe(t *testing.T) {
+	res := run(t, newServer(t), "describe")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		`"IPAddressesHandler" (Auth):`,
+		`Name: "reserve"`,
+		`"requested_address":`,
+		`409: if the requested address is already allocated.`,
+		`Path: "/api/1.0/nodegroups/{uuid}/interfaces/"`,
+	)
+}
+
+func TestMissingOAuthKey(t *testing.T) {
+	srv := newServer(t)
+	cmd := exec.Command(os.Args[0], "-o", "", "list-ips")
+	cmd.Env = append(os.Environ(), envRunMain+"=1", envServerURL+"="+srv.URL, envOAuthKey+"=")
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2, got %v", err)
+	}
+	assertContains(t, string(out), "MAAS OAuth key not specified.")
+}
+
+func TestListFormats(t *testing.T) {
+	srv := newServer(t)
+
+	res := run(t, srv, "--format", "json", "list-networks")
+	assertCode(t, res, 0)
+	var networks []map[string]interface{}
+	if err := json.Unmarshal([]byte(res.stdout), &networks); err != nil {
+		t.Fatalf("cannot decode JSON output: %v\n%s", err, res.stdout)
+	}
+	if len(networks) != 2 || networks[0]["name"] != "maas-eth0" {
+		t.Fatalf("unexpected networks: %v", networks)
+	}
+	if nm, pl := networks[0]["netmask"], networks[0]["prefix_length"]; nm != "255.255.255.0" || pl != 24.0 {
+		t.Fatalf("unexpected netmask %v and prefix length %v", nm, pl)
+	}
+
+	res = run(t, srv, "--format", "json", "list-ips")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `"ip": "10.20.0.100"`, `"alloc_type": "UserReserved"`, `"created": "`)
+
+	res = run(t, srv, "--format", "yaml", "list-nics")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"- cluster_id: ng-1\n  name: eth0\n",
+		"management: ManageDNSAndDHCP",
+		"static_range_low: 10.20.0.100",
+		"netmask: 255.255.255.0",
+	)
+
+	res = run(t, srv, "--format", "tabular", "list-nics")
+	assertCode(t, res, 0)
+	lines := strings.Split(strings.TrimSpace(res.stdout), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "CLUSTER") {
+		t.Fatalf("unexpected tabular output:\n%s", res.stdout)
+	}
+	assertContains(t, lines[1], "10.20.0.10-10.20.0.99", "10.20.0.100-10.20.0.110")
+
+	res = run(t, srv, "--format", "xml", "list-ips")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, `unsupported format "xml"`)
+
+	res = run(t, srv, "--format", "json", "watch", "--polls", "1")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "--format is not supported by watch")
+}
+
+func TestListTemplate(t *testing.T) {
+	srv := newServer(t)
+
+	res := run(t, srv, "list-ips", "--template", "{{.IP}} {{.AllocType}}")
+	assertCode(t, res, 0)
+	if res.stdout != "10.20.0.100 UserReserved\n10.20.0.105 Auto\n" {
+		t.Fatalf("unexpected output:\n%s", res.stdout)
+	}
+
+	res = run(t, srv, "list-networks", "--template", "{{.Name}} {{cidr .}} {{netmask .Netmask}} {{prefix .Netmask}}")
+	assertCode(t, res, 0)
+	if res.stdout != "maas-eth0 10.20.0.0/24 255.255.255.0 24\nvlan-42 10.42.0.0/24 255.255.255.0 24\n" {
+		t.Fatalf("unexpected output:\n%s", res.stdout)
+	}
+
+	tmpl := `{{.Name}} {{cidr .}} {{ipRange .StaticRangeLowIP .StaticRangeHighIP}}` +
+		`{{if .HasStaticRange}} {{rangeSize .StaticRangeLowIP .StaticRangeHighIP}}` +
+		` {{inRange .RouterIP .DHCPRangeLowIP .DHCPRangeHighIP}}{{end}}`
+	res = run(t, srv, "list-nics", "--template", tmpl)
+	assertCode(t, res, 0)
+	if res.stdout != "eth0 10.20.0.0/24 10.20.0.100-10.20.0.110 11 false\neth0.42 10.42.0.0/24 \n" {
+		t.Fatalf("unexpected output:\n%q", res.stdout)
+	}
+
+	res = run(t, srv, "list-ips", "--template", "{{.IP")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "invalid template")
+
+	res = run(t, srv, "--format", "json", "list-ips", "--template", "{{.IP}}")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "--template and --format cannot be used together")
+}
+
+func TestReserveIPv6(t *testing.T) {
+	srv := newServer(t)
+	srv.AddNetwork(maastest.Network{
+		Name:    "maas-v6",
+		IP:      "2001:db8:1::",
+		Netmask: "ffff:ffff:ffff:ffff::",
+	})
+	srv.AddNodeGroup("ng-2", maastest.NodeGroupInterface{
+		Name:              "eth1",
+		Interface:         "eth1",
+		IP:                "2001:db8:1::1",
+		SubnetMask:        "ffff:ffff:ffff:ffff::",
+		StaticIPRangeLow:  "2001:db8:1::1:0",
+		StaticIPRangeHigh: "2001:db8:1::ffff:ffff",
+		Management:        2,
+	})
+
+	res := run(t, srv, "reserve-ip", "maas-v6", "2001:db8:1::1:5")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `allocated IP address "2001:db8:1::1:5" on network "maas-v6"`)
+
+	res = run(t, srv, "reserve-ip", "maas-v6", "2001:db8:2::5")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, `not within network "maas-v6" range "2001:db8:1::/64"`)
+
+	res = run(t, srv, "reserve-ip", "maas-v6", "random")
+	assertCode(t, res, 0)
+	var random net.IP
+	for _, ip := range srv.IPs() {
+		if addr := net.ParseIP(ip.IP); addr.To4() == nil && ip.IP != "2001:db8:1::1:5" {
+			random = addr
+		}
+	}
+	low, high := net.ParseIP("2001:db8:1::1:0"), net.ParseIP("2001:db8:1::ffff:ffff")
+	if random == nil || bytes.Compare(random, low) < 0 || bytes.Compare(random, high) > 0 {
+		t.Fatalf("expected a random IP within the static range, got %v", srv.IPs())
+	}
+
+	res = run(t, srv, "list-nics", "--template", "{{if .HasStaticRange}}{{cidr .}} {{prefix .Netmask}} {{rangeSize .StaticRangeLowIP .StaticRangeHighIP}}{{end}}")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "2001:db8:1::/64 64 4294901760\n")
+}
+
+func TestReserveIPCount(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "reserve-ip", "maas-eth0", "first-free", "--count", "3")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "reserved 3 IP addresses on network \"maas-eth0\" successfully.")
+	assertContains(t, strings.Join(serverIPs(srv), " "), "10.20.0.100 10.20.0.101 10.20.0.102 10.20.0.103 10.20.0.105")
+
+	res = run(t, srv, "reserve-ip", "maas-eth0", "--count", "2")
+	assertCode(t, res, 0)
+	assertContains(t, strings.Join(serverIPs(srv), " "), "10.20.0.104 10.20.0.105 10.20.0.106")
+
+	res = run(t, srv, "reserve-ip", "maas-eth0", "10.20.0.108", "--count", "2")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "use --contiguous")
+}
+
+func TestReserveIPContiguous(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "reserve-ip", "maas-eth0", "--count", "4", "--contiguous")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "trying to reserve 4 contiguous IP addresses (10.20.0.101-10.20.0.104)")
+
+	srv = newServer(t)
+	res = run(t, srv, "reserve-ip", "maas-eth0", "last-free", "--count", "3", "--contiguous")
+	assertCode(t, res, 0)
+	assertContains(t, strings.Join(serverIPs(srv), " "), "10.20.0.108 10.20.0.109 10.20.0.110")
+
+	res = run(t, srv, "reserve-ip", "maas-eth0", "--count", "6", "--contiguous")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "no 6 consecutive free addresses in range 10.20.0.100-10.20.0.110")
+}
+
+func TestReserveIPContiguousRollback(t *testing.T) {
+	srv := newServer(t)
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.103", AllocType: maastest.AllocUserReserved, Hidden: true})
+	before := serverIPs(srv)
+
+	res := run(t, srv, "reserve-ip", "maas-eth0", "10.20.0.101", "--count", "3", "--contiguous")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr,
+		`rolling back: releasing IP address "10.20.0.102"`,
+		`rolling back: releasing IP address "10.20.0.101"`,
+		"409 Conflict",
+	)
+	if after := serverIPs(srv); strings.Join(after, " ") != strings.Join(before, " ") {
+		t.Fatalf("expected IPs %v after rollback, got %v", before, after)
+	}
+
+	// Without an explicit start, another block is picked, after the
+	// conflicting IP and 10.20.0.105.
+	res = run(t, srv, "reserve-ip", "maas-eth0", "first-free", "--count", "3", "--contiguous")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `IP address "10.20.0.103" is already in use, retrying (1 of 3)`)
+	assertContains(t, strings.Join(serverIPs(srv), " "), "10.20.0.105 10.20.0.106 10.20.0.107 10.20.0.108")
+}
+
+func TestDryRun(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "reserve-ip", "maas-eth0", "first-free", "--count", "2", "--dry-run")
+	assertCode(t, res, 0)
+	prefix := "POST " + srv.URL + "/api/1.0/ipaddresses/?op=reserve "
+	assertContains(t, res.stdout, prefix+"network=10.20.0.0%2F24&requested_address=10.20.0.101\n")
+	assertContains(t, res.stdout, prefix+"network=10.20.0.0%2F24&requested_address=10.20.0.102\n")
+	assertContains(t, res.stderr, `dry run: matched network "maas-eth0" to interface "eth0" on node group "ng-1"`)
+
+	res = run(t, srv, "reserve-ip", "maas-eth0", "--dry-run")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, prefix+"network=10.20.0.0%2F24\n")
+
+	res = run(t, srv, "release-ips", "--dry-run")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "POST "+srv.URL+"/api/1.0/ipaddresses/?op=release ip=10.20.0.100\n")
+	assertContains(t, res.stderr, "dry run: no IPs released.")
+
+	for _, req := range srv.Requests() {
+		if strings.HasPrefix(req, "POST") {
+			t.Errorf("unexpected request with --dry-run: %s", req)
+		}
+	}
+	if ips := serverIPs(srv); strings.Join(ips, " ") != "10.20.0.100 10.20.0.105" {
+		t.Fatalf("unexpected IPs: %v", ips)
+	}
+}
+
+func TestReleaseIPsConcurrently(t *testing.T) {
+	srv := newServer(t)
+	for _, ip := range []string{"10.20.0.101", "10.20.0.102", "10.20.0.103"} {
+		srv.AddIP(maastest.StaticIP{IP: ip, AllocType: maastest.AllocUserReserved})
+	}
+	res := run(t, srv, "--format", "json", "release-ips", "--yes", "--workers", "3", "--rate", "100")
+	assertCode(t, res, 1)
+	assertContains(t, res.stderr, "4 IPs successfully released; 1 failures")
+
+	var summary struct {
+		Released []string
+		Failed   []struct {
+			IP         string
+			Error      string
+			StatusCode int `json:"status_code"`
+		}
+	}
+	if err := json.Unmarshal([]byte(res.stdout), &summary); err != nil {
+		t.Fatalf("cannot parse summary: %v\n%s", err, res.stdout)
+	}
+	if got := strings.Join(summary.Released, " "); got != "10.20.0.100 10.20.0.101 10.20.0.102 10.20.0.103" {
+		t.Errorf("unexpected released IPs: %s", got)
+	}
+	if len(summary.Failed) != 1 || summary.Failed[0].IP != "10.20.0.105" || summary.Failed[0].StatusCode != 404 {
+		t.Errorf("unexpected failures: %+v", summary.Failed)
+	}
+	if ips := serverIPs(srv); strings.Join(ips, " ") != "10.20.0.105" {
+		t.Fatalf("unexpected IPs left: %v", ips)
+	}
+
+	res = run(t, srv, "release-ips", "--workers", "0")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "invalid --workers 0")
+
+	res = run(t, srv, "release-ips", "--rate", "NaN")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "invalid --rate NaN")
+
+	// Rates too high for a ticker are unlimited.
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.106", AllocType: maastest.AllocUserReserved})
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.107", AllocType: maastest.AllocUserReserved})
+	res = run(t, srv, "release-ips", "--yes", "--rate", "1e12", "10.20.0.106", "10.20.0.107")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `IP "10.20.0.106" released.`, `IP "10.20.0.107" released.`)
+}
+
+func TestLint(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "lint")
+	assertCode(t, res, 1)
+	if res.stdout != "no-static-range: interface \"eth0.42\" of node group \"ng-1\": matches network \"vlan-42\", but has no static range\n" {
+		t.Fatalf("unexpected output:\n%s", res.stdout)
+	}
+	assertContains(t, res.stderr, "found 1 problems in 2 networks and 2 interfaces")
+
+	srv.AddNetwork(maastest.Network{Name: "lonely", IP: "10.99.0.0", Netmask: "255.255.0.0", VLANTag: 42, Gateway: "10.98.0.1"})
+	srv.AddNetwork(maastest.Network{Name: "unmanaged", IP: "10.30.0.0", Netmask: "255.255.255.0"})
+	srv.AddNodeGroup("ng-2", maastest.NodeGroupInterface{
+		Name:              "eth1",
+		Interface:         "eth1",
+		IP:                "10.30.0.2",
+		SubnetMask:        "255.255.255.0",
+		IPRangeLow:        "10.30.0.10",
+		IPRangeHigh:       "10.30.0.50",
+		StaticIPRangeLow:  "10.30.0.50",
+		StaticIPRangeHigh: "10.30.1.10",
+	})
+	res = run(t, srv, "lint")
+	assertCode(t, res, 1)
+	assertContains(t, res.stdout,
+		`range-outside-subnet: interface "eth1" of node group "ng-2": static range 10.30.0.50-10.30.1.10 is outside 10.30.0.0/24`,
+		`static-dhcp-overlap: interface "eth1" of node group "ng-2": static range 10.30.0.50-10.30.1.10 overlaps DHCP range 10.30.0.10-10.30.0.50`,
+		`gateway-outside-subnet: network "lonely": gateway 10.98.0.1 is outside 10.99.0.0/16`,
+		`no-interface: network "lonely": no node group interface has a router IP within 10.99.0.0/16`,
+		`unmanaged-interface: interface "eth1" of node group "ng-2": matches network "unmanaged", but is unmanaged`,
+		`duplicate-vlan-tag: networks: VLAN tag 42 used by networks "lonely", "vlan-42"`,
+	)
+
+	res = run(t, srv, "--format", "json", "lint")
+	assertCode(t, res, 1)
+	var issues []maas.Issue
+	if err := json.Unmarshal([]byte(res.stdout), &issues); err != nil {
+		t.Fatalf("cannot parse issues: %v\n%s", err, res.stdout)
+	}
+	if len(issues) != 7 || issues[0].Check != maas.CheckRangeOutsideSubnet || issues[0].ClusterID != "ng-2" {
+		t.Fatalf("unexpected issues: %+v", issues)
+	}
+	clean := maastest.NewServer()
+	defer clean.Close()
+	res = run(t, clean, "--format", "json", "lint")
+	assertCode(t, res, 0)
+	if res.stdout != "[]\n" {
+		t.Fatalf("expected an empty JSON list, got:\n%s", res.stdout)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "usage")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		`network "maas-eth0" (interface "eth0" of node group "ng-1"): 9 of 11 static IPs free (18.2% utilized), 90 DHCP IPs
+  allocated: Auto=1 UserReserved=1`,
+		`network "vlan-42" (interface "eth0.42" of node group "ng-1"): no static range, 0 DHCP IPs`,
+	)
+
+	res = run(t, srv, "--format", "tabular", "usage", "maas-eth0")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "maas-eth0  ng-1     eth0       11           Auto=1 UserReserved=1  9     90         18.2%")
+
+	res = run(t, srv, "--format", "json", "usage", "--max-utilization", "15")
+	assertCode(t, res, 1)
+	assertContains(t, res.stderr, `static range of network "maas-eth0" is 18.2% utilized (threshold: 15%)`, "1 of 2 static IP pools are nearly exhausted")
+	var pools []struct {
+		Free      string
+		Allocated map[string]int
+	}
+	if err := json.Unmarshal([]byte(res.stdout), &pools); err != nil {
+		t.Fatalf("cannot parse usage: %v\n%s", err, res.stdout)
+	}
+	if len(pools) != 2 || pools[0].Free != "9" || pools[0].Allocated["UserReserved"] != 1 {
+		t.Fatalf("unexpected usage: %+v", pools)
+	}
+
+	res = run(t, srv, "--format", "yaml", "usage", "maas-eth0")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `static_size: "11"`, `free: "9"`, `dhcp_size: "90"`)
+
+	res = run(t, srv, "usage", "--min-free", "10")
+	assertCode(t, res, 1)
+	assertContains(t, res.stderr, `static range of network "maas-eth0" has 9 free addresses left (threshold: 10)`)
+
+	res = run(t, srv, "usage", "--min-free", "9", "--max-utilization", "20", "--template", "{{.Network}} {{.Free}}")
+	assertCode(t, res, 0)
+	if res.stdout != "maas-eth0 9\nvlan-42 0\n" {
+		t.Fatalf("unexpected output:\n%s", res.stdout)
+	}
+}
+
+func TestWhoisIP(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "whois-ip", "10.20.0.105")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"IP: 10.20.0.105\nNetwork: maas-eth0 (10.20.0.0/24)\nInterface: eth0 of node group ng-1",
+		"Range: static (10.20.0.100-10.20.0.110)\nAllocated: Auto, created ",
+	)
+
+	res = run(t, srv, "whois-ip", "10.20.0.50")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "Range: DHCP (10.20.0.10-10.20.0.99)\nAllocated: no")
+
+	res = run(t, srv, "whois-ip", "10.42.0.7")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "Network: vlan-42 (10.42.0.0/24)\nInterface: eth0.42 of node group ng-1", "Range: none\nAllocated: no")
+
+	res = run(t, srv, "--format", "tabular", "whois-ip", "192.168.1.1")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "192.168.1.1  -        -        -          none   -           -")
+
+	res = run(t, srv, "--format", "json", "whois-ip", "10.20.0.100")
+	assertCode(t, res, 0)
+	var infos []struct {
+		Network    struct{ Name string }
+		Interface  struct{ Name string }
+		Range      string
+		Allocation struct {
+			AllocType string `json:"alloc_type"`
+		}
+	}
+	if err := json.Unmarshal([]byte(res.stdout), &infos); err != nil {
+		t.Fatalf("cannot parse output: %v\n%s", err, res.stdout)
+	}
+	if len(infos) != 1 || infos[0].Network.Name != "maas-eth0" || infos[0].Interface.Name != "eth0" ||
+		infos[0].Range != "static" || infos[0].Allocation.AllocType != "UserReserved" {
+		t.Fatalf("unexpected output: %+v", infos)
+	}
+
+	res = run(t, srv, "whois-ip", "foo")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, `invalid IP address "foo"`)
+}
+
+func TestFreeIPs(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "free-ips", "maas-eth0")
+	assertCode(t, res, 0)
+	if res.stdout != "10.20.0.101-10.20.0.104 (4 free)\n10.20.0.106-10.20.0.110 (5 free)\n" {
+		t.Fatalf("unexpected output:\n%s", res.stdout)
+	}
+	assertContains(t, res.stderr, `9 of 11 addresses free in static range 10.20.0.100-10.20.0.110 of network "maas-eth0"`)
+
+	res = run(t, srv, "free-ips", "maas-eth0", "--map", "--width", "200")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"\n["+strings.Repeat("D", 90)+"#....#.....]\n",
+		"each character is 1 address(es)",
+	)
+
+	res = run(t, srv, "free-ips", "--map", "maas-eth0")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"10.20.0.10"+strings.Repeat(" ", 32)+"10.20.0.110\n["+strings.Repeat("D", 45)+"+.+...]\n",
+		"each character is 2 address(es)",
+	)
+
+	res = run(t, srv, "--format", "json", "free-ips", "maas-eth0")
+	assertCode(t, res, 0)
+	var ranges []struct {
+		Low, High, Size string
+	}
+	if err := json.Unmarshal([]byte(res.stdout), &ranges); err != nil {
+		t.Fatalf("cannot parse output: %v\n%s", err, res.stdout)
+	}
+	if len(ranges) != 2 || ranges[1].Low != "10.20.0.106" || ranges[1].High != "10.20.0.110" || ranges[1].Size != "5" {
+		t.Fatalf("unexpected output: %+v", ranges)
+	}
+
+	res = run(t, srv, "--format", "yaml", "free-ips", "maas-eth0")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "- low: 10.20.0.106\n  high: 10.20.0.110\n  size: \"5\"\n")
+
+	for i := 100; i <= 110; i++ {
+		srv.AddIP(maastest.StaticIP{IP: fmt.Sprintf("10.20.0.%d", i), AllocType: maastest.AllocUserReserved})
+	}
+	res = run(t, srv, "--format", "json", "free-ips", "maas-eth0")
+	assertCode(t, res, 0)
+	if res.stdout != "[]\n" {
+		t.Fatalf("expected an empty JSON list, got %q", res.stdout)
+	}
+
+	res = run(t, srv, "free-ips", "vlan-42")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, `matches network "vlan-42" but has no static range`)
+}
+
+func TestExportPlanApply(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "export")
+	assertCode(t, res, 0)
+	exported := res.stdout
+	assertContains(t, exported, `networks:
+- name: maas-eth0
+  ip: 10.20.0.0
+  netmask: 255.255.255.0
+  gateway: 10.20.0.1
+  dns_servers:
+  - 10.20.0.2
+`, `interfaces:
+- cluster_id: ng-1
+  name: eth0
+  interface: eth0
+  router_ip: 10.20.0.2
+  netmask: 255.255.255.0
+  broadcast_ip: 10.20.0.255
+  management: ManageDNSAndDHCP
+  dhcp_range_low: 10.20.0.10
+  dhcp_range_high: 10.20.0.99
+  static_range_low: 10.20.0.100
+  static_range_high: 10.20.0.110
+`)
+
+	res = runWithInput(t, srv, exported, "plan", "-")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "0 changes: 0 to create, 0 to update")
+
+	res = runWithInput(t, srv, exported, "--format", "json", "plan", "-")
+	assertCode(t, res, 0)
+	if res.stdout != "[]\n" {
+		t.Fatalf("expected an empty JSON list, got %q", res.stdout)
+	}
+
+	desired := strings.Replace(exported, "static_range_high: 10.20.0.110", "static_range_high: 10.20.0.150", 1)
+	desired = strings.Replace(desired, "  management: ManageDHCPOnly\n", "  management: 2\n  static_range_low: 10.42.0.100\n  static_range_high: 10.42.0.120\n", 1)
+	desired = strings.Replace(desired, "interfaces:\n", `- name: new-net
+  ip: 10.50.0.0
+  netmask: 255.255.0.0
+  vlan_tag: 50
+interfaces:
+- cluster_id: ng-1
+  name: eth1
+  router_ip: 10.50.0.2
+  netmask: 255.255.0.0
+`, 1)
+	path := filepath.Join(t.TempDir(), "maas.yaml")
+	if err := os.WriteFile(path, []byte(desired), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res = run(t, srv, "plan", path)
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"create network \"new-net\"\n  name: \"new-net\"\n  ip: \"10.50.0.0\"\n  netmask: \"255.255.0.0\"\n  vlan_tag: \"50\"\n",
+		"update interface \"eth0\" of node group \"ng-1\"\n  static_range_high: \"10.20.0.110\" -> \"10.20.0.150\"\n",
+		"update interface \"eth0.42\" of node group \"ng-1\"\n  management: \"ManageDHCPOnly\" -> \"ManageDNSAndDHCP\"\n  static_range_low: \"\" -> \"10.42.0.100\"\n",
+		"create interface \"eth1\" of node group \"ng-1\"\n  name: \"eth1\"\n  interface: \"eth1\"\n  router_ip: \"10.50.0.2\"\n  netmask: \"255.255.0.0\"\n  management: \"Unmanaged\"\n",
+	)
+	assertContains(t, res.stderr, "4 changes: 2 to create, 2 to update")
+
+	res = run(t, srv, "apply", path, "--dry-run")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"POST "+srv.URL+"/api/1.0/networks/?op= ip=10.50.0.0&name=new-net&netmask=255.255.0.0&vlan_tag=50\n",
+		"PUT "+srv.URL+"/api/1.0/nodegroups/ng-1/interfaces/eth0/ static_ip_range_high=10.20.0.150\n",
+		"POST "+srv.URL+"/api/1.0/nodegroups/ng-1/interfaces/?op=new ",
+	)
+
+	res = run(t, srv, "apply", "--yes", path)
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "applied 4 changes successfully.")
+	for _, req := range []string{
+		"POST /api/1.0/networks/?op=",
+		"PUT /api/1.0/nodegroups/ng-1/interfaces/eth0/",
+		"PUT /api/1.0/nodegroups/ng-1/interfaces/eth0.42/",
+		"POST /api/1.0/nodegroups/ng-1/interfaces/?op=new",
+	} {
+		assertContains(t, strings.Join(srv.Requests(), "\n")+"\n", req+"\n")
+	}
+	nics := srv.NodeGroupInterfaces("ng-1")
+	if len(nics) != 3 || nics[0].StaticIPRangeHigh != "10.20.0.150" || nics[1].Management != 2 || nics[2].SubnetMask != "255.255.0.0" {
+		t.Fatalf("unexpected interfaces: %+v", nics)
+	}
+	if nws := srv.Networks(); len(nws) != 3 || nws[1].Name != "new-net" || nws[1].VLANTag != 50 {
+		t.Fatalf("unexpected networks: %+v", nws)
+	}
+
+	res = run(t, srv, "plan", path)
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "0 changes: 0 to create, 0 to update")
+
+	res = runWithInput(t, srv, "networks:\n- name: foo\n  ip: bar\n", "plan", "-")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, `invalid network #1: invalid ip "bar"`)
+}
+
+func TestBackupRestoreIPs(t *testing.T) {
+	srv := newServer(t)
+	for _, ip := range []string{"10.20.0.106", "10.20.0.107", "10.20.0.108", "10.42.0.5", "192.168.0.1"} {
+		srv.AddIP(maastest.StaticIP{IP: ip, AllocType: maastest.AllocUserReserved, Created: "2015-06-01T10:00:00.000000"})
+	}
+	path := filepath.Join(t.TempDir(), "ips.yaml")
+	res := run(t, srv, "backup-ips", path)
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, `IP "192.168.0.1" is not within any network, skipping.`, "backed up 5 user-reserved IPs.")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, string(data), `
+- ip: 10.20.0.106
+  network: maas-eth0
+  cidr: 10.20.0.0/24
+  created: "2015-06-01T10:00:00Z"
+`)
+	if strings.Contains(string(data), "10.20.0.105") {
+		t.Fatalf("unexpected non-user-reserved IP in backup:\n%s", data)
+	}
+
+	// A rebuilt MAAS, where some of the IPs are allocated already.
+	rebuilt := newServer(t)
+	rebuilt.AddIP(maastest.StaticIP{IP: "10.20.0.106", AllocType: maastest.AllocUserReserved, Hidden: true})
+	rebuilt.AddIP(maastest.StaticIP{IP: "10.20.0.108", AllocType: 0})
+
+	res = run(t, rebuilt, "restore-ips", path, "--dry-run")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "POST "+rebuilt.URL+"/api/1.0/ipaddresses/?op=reserve network=10.20.0.0%2F24&requested_address=10.20.0.107\n")
+	if ips := serverIPs(rebuilt); len(ips) != 4 {
+		t.Fatalf("unexpected IPs after dry run: %v", ips)
+	}
+
+	res = run(t, rebuilt, "--format", "tabular", "restore-ips", path, "--dry-run")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "10.20.0.107  maas-eth0  would-restore  -")
+	if strings.Contains(res.stdout, " restored ") {
+		t.Fatalf("unexpected restored IPs in dry run:\n%s", res.stdout)
+	}
+
+	res = run(t, rebuilt, "--format", "tabular", "restore-ips", path)
+	assertCode(t, res, 1)
+	assertContains(t, res.stderr,
+		`IP "10.20.0.100" is already reserved, skipping.`,
+		`IP "10.20.0.107" restored on network "maas-eth0".`,
+		`IP "10.20.0.108" is already allocated as Auto`,
+		"1 IPs restored; 1 skipped; 2 conflicts; 1 failures",
+	)
+	assertContains(t, res.stdout,
+		"10.20.0.100  maas-eth0  skipped   -",
+		"10.20.0.106  maas-eth0  conflict  ",
+		"10.42.0.5    vlan-42    failed    ",
+	)
+	if ips := strings.Join(serverIPs(rebuilt), " "); ips != "10.20.0.100 10.20.0.105 10.20.0.106 10.20.0.107 10.20.0.108" {
+		t.Fatalf("unexpected IPs after restore: %v", ips)
+	}
+}
+
+// waitForRequests waits until srv served at least n requests matching
+// request.
+func waitForRequests(t *testing.T, srv *maastest.Server, request string, n int) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		count := 0
+		for _, req := range srv.Requests() {
+			if req == request {
+				count++
+			}
+		}
+		if count >= n {
+			return
+		}
+	}
+	t.Errorf("timed out waiting for %d %q requests", n, request)
+}
+
+func TestWatch(t *testing.T) {
+	srv := newServer(t)
+	go func() {
+		// Change the state after each poll.
+		waitForRequests(t, srv, "GET /api/1.0/ipaddresses/", 1)
+		srv.AddIP(maastest.StaticIP{IP: "10.20.0.106", AllocType: maastest.AllocUserReserved, Created: "2015-06-01T10:00:00.000000"})
+		srv.AddNetwork(maastest.Network{Name: "new-net", IP: "10.50.0.0", Netmask: "255.255.0.0"})
+		waitForRequests(t, srv, "GET /api/1.0/ipaddresses/", 2)
+		srv.RemoveIP("10.20.0.100")
+	}()
+	res := run(t, srv, "watch", "--interval", "200ms", "--polls", "3")
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "found 2 static IPs and 2 networks")
+	lines := strings.Split(strings.TrimSpace(res.stdout), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 events, got:\n%s", res.stdout)
+	}
+	for i, expected := range []string{
+		" network-added new-net (10.50.0.0/16)",
+		" ip-added 10.20.0.106 (UserReserved, created 2015-06-01T10:00:00Z)",
+		" ip-removed 10.20.0.100 (UserReserved, created ",
+	} {
+		assertContains(t, lines[i], expected)
+	}
+
+	srv = newServer(t)
+	go func() {
+		waitForRequests(t, srv, "GET /api/1.0/ipaddresses/", 1)
+		srv.RemoveIP("10.20.0.105")
+	}()
+	res = run(t, srv, "watch", "--interval", "200ms", "--polls", "2", "--json")
+	assertCode(t, res, 0)
+	var event struct {
+		Type string
+		IP   struct {
+			IP        string
+			AllocType string `json:"alloc_type"`
+		}
+	}
+	if err := json.Unmarshal([]byte(res.stdout), &event); err != nil {
+		t.Fatalf("cannot parse event: %v\n%s", err, res.stdout)
+	}
+	if event.Type != "ip-removed" || event.IP.IP != "10.20.0.105" || event.IP.AllocType != "Auto" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+// getMetrics waits until serve-metrics listening on addr responds and
+// returns the metrics it serves.
+func getMetrics(t *testing.T, addr string) string {
+	t.Helper()
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		var resp *http.Response
+		if resp, err = http.Get("http://" + addr + "/metrics"); err != nil {
+			continue
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("cannot read metrics: %v", err)
+		}
+		return string(data)
+	}
+	t.Fatalf("cannot get metrics: %v", err)
+	return ""
+}
+
+func TestServeMetrics(t *testing.T) {
+	srv := newServer(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cmd := exec.Command(os.Args[0], "serve-metrics", "--listen", addr, "--interval", "100ms")
+	cmd.Env = append(os.Environ(),
+		envRunMain+"=1",
+		envServerURL+"="+srv.URL,
+		envOAuthKey+"=consumer:token:secret",
+	)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	assertContains(t, getMetrics(t, addr),
+		`maas_static_pool_size{cluster="ng-1",interface="eth0",network="maas-eth0"} 11`,
+		`maas_static_pool_free{cluster="ng-1",interface="eth0",network="maas-eth0"} 9`,
+		`maas_static_ips_allocated{alloc_type="Auto",cluster="ng-1",interface="eth0",network="maas-eth0"} 1`,
+		`maas_static_ips_allocated{alloc_type="UserReserved",cluster="ng-1",interface="eth0",network="maas-eth0"} 1`,
+		`maas_static_ips_allocated{alloc_type="Sticky",cluster="ng-1",interface="eth0",network="maas-eth0"} 0`,
+		`maas_static_ips_allocated{alloc_type="Auto",cluster="ng-1",interface="eth0.42",network="vlan-42"} 0`,
+		`maas_dhcp_range_size{cluster="ng-1",interface="eth0",network="maas-eth0"} 90`,
+		`maas_static_pool_size{cluster="ng-1",interface="eth0.42",network="vlan-42"} 0`,
+		"maas_scrape_errors_total 0",
+		"maas_last_scrape_timestamp_seconds ",
+	)
+
+	// Refreshes pick up changes and failures are counted, keeping the
+	// last known values.
+	srv.AddIP(maastest.StaticIP{IP: "10.20.0.106", AllocType: maastest.AllocUserReserved})
+	waitForRequests(t, srv, "GET /api/1.0/ipaddresses/", 2)
+	waitForRequests(t, srv, "GET /api/1.0/networks/", 3)
+	assertContains(t, getMetrics(t, addr),
+		`maas_static_ips_allocated{alloc_type="UserReserved",cluster="ng-1",interface="eth0",network="maas-eth0"} 2`,
+	)
+	srv.Close()
+	time.Sleep(300 * time.Millisecond)
+	metrics := getMetrics(t, addr)
+	assertContains(t, metrics, `maas_static_pool_free{cluster="ng-1",interface="eth0",network="maas-eth0"} 8`)
+	if strings.Contains(metrics, "maas_scrape_errors_total 0") {
+		t.Errorf("expected scrape errors, got:\n%s", metrics)
+	}
+}
+
+func TestCall(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "call", "IPAddresses", "reserve", "network=10.20.0.0/24", "requested_address=10.20.0.107")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `"ip": "10.20.0.107"`)
+
+	res = run(t, srv, "--format", "yaml", "call", "ipaddresses/", "read")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "- alloc_type: 4", "ip: 10.20.0.107")
+
+	res = run(t, srv, "call", "nodegroups/ng-1/interfaces/", "list")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `"name": "eth0.42"`)
+
+	// Handler names work too, with the path params given as key=value.
+	res = run(t, srv, "call", "NodeGroupInterfacesHandler", "list", "uuid=ng-1")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `"name": "eth0.42"`)
+
+	// Actions without documented params accept any.
+	res = run(t, srv, "call", "networks/vlan-42/", "update", "description=tagged")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `"description": "tagged"`)
+
+	res = run(t, srv, "call", "networks", "create", "--dry-run", "name=new", "ip=10.50.0.0", "netmask=255.255.0.0", "vlan_tag=0x2a")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "POST "+srv.URL+"/api/1.0/networks/?op= ", "vlan_tag=42")
+	if n := len(srv.Networks()); n != 2 {
+		t.Fatalf("expected 2 networks after dry run, got %d", n)
+	}
+
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"call", "ipaddresses"}, "resource and action to call not specified."},
+		{[]string{"call", "machines", "read"}, `unknown resource "machines"`},
+		{[]string{"call", "ipaddresses", "allocate"}, `IPAddressesHandler has no action "allocate" (expected one of: read, release, reserve)`},
+		{[]string{"call", "ipaddresses", "release", "address=10.20.0.100"}, `unknown param "address" of IPAddressesHandler release (expected one of: ip)`},
+		{[]string{"call", "ipaddresses", "release", "10.20.0.100"}, `invalid argument "10.20.0.100": expected key=value`},
+		{[]string{"call", "NodeGroupInterfaces", "list"}, "missing uuid=<value> for the path of NodeGroupInterfacesHandler (nodegroups/{uuid}/interfaces/)"},
+		{[]string{"call", "nodegroups/ng-1/interfaces/", "new", "ip=bogus"}, `invalid param "ip": expected an IP address, got "bogus"`},
+		{[]string{"call", "networks", "create", "vlan_tag=x"}, `invalid param "vlan_tag": expected an integer, got "x"`},
+		{[]string{"call", "ipaddresses", "release", "ip=10.20.0.200"}, "IPAddressesHandler release failed"},
+	} {
+		res := run(t, srv, test.args...)
+		assertCode(t, res, 2)
+		assertContains(t, res.stderr, test.expected)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "--offline", "describe")
+	assertCode(t, res, 3)
+	assertContains(t, res.stdout, fmt.Sprintf("no cached API description of %q", srv.URL))
+
+	res = run(t, srv, "describe")
+	assertCode(t, res, 0)
+	online := res.stdout
+
+	key := fmt.Sprintf("%x", sha1.Sum([]byte(srv.URL)))
+	cached, err := filepath.Glob(filepath.Join(os.Getenv("XDG_CACHE_HOME"), "maas-utils", "api", key, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 3 {
+		t.Fatalf("expected the index, raw and parsed JSON to be cached, got %v", cached)
+	}
+
+	// Cached descriptions are used when the hash has not changed.
+	res = run(t, srv, "describe")
+	assertCode(t, res, 0)
+	if res.stdout != online {
+		t.Fatalf("describe output changed after caching:\n%s", res.stdout)
+	}
+
+	srv.Close()
+	res = run(t, srv, "--offline", "describe")
+	assertCode(t, res, 0)
+	if res.stdout != online {
+		t.Fatalf("offline describe output differs from online:\n%s", res.stdout)
+	}
+	res = run(t, srv, "--offline", "describe", "--format", "markdown")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "#### reserve")
+
+	res = run(t, srv, "--offline", "call", "ipaddresses", "reserve", "--dry-run", "network=10.20.0.0/24")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "POST "+srv.URL+"/api/1.0/ipaddresses/?op=reserve", "network=10.20.0.0%2F24")
+
+	res = run(t, srv, "--offline", "list-ips")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "--offline is only supported by describe and call.")
+}
+
+func TestDescribeGenerateGo(t *testing.T) {
+	res := run(t, newServer(t), "describe", "--generate-go")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"// Code generated by maas-utils describe --generate-go. DO NOT EDIT.",
+		"package maasapi",
+		"func (c *Client) IPAddressesReserve(params IPAddressesReserveParams) (interface{}, error) {",
+		"// Returns 409 if the requested address is already allocated.",
+		"func (c *Client) NodeGroupInterfaceUpdate(uuid string, name string, params url.Values) (interface{}, error) {",
+		"\tVLANTag int\n",
+	)
+
+	res = run(t, newServer(t), "describe", "--generate-go", "--package", "foo")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, "package foo")
+
+	srv := newServer(t)
+	client, err := maas.NewClient(srv.URL, "consumer:token:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := maasapi.NewClient(client)
+	result, err := api.IPAddressesReserve(maasapi.IPAddressesReserveParams{
+		Network:          "10.20.0.0/24",
+		RequestedAddress: "10.20.0.107",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip := result.(map[string]interface{})["ip"]; ip != "10.20.0.107" {
+		t.Fatalf("unexpected reserved IP: %v", ip)
+	}
+	result, err = api.NodeGroupInterfacesList("ng-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nics := result.([]interface{}); len(nics) != 2 {
+		t.Fatalf("expected 2 interfaces, got %v", nics)
+	}
+	_, err = api.NetworkUpdate("missing", url.Values{"description": {"x"}})
+	if maas.StatusCode(err) != 404 {
+		t.Fatalf("expected a 404 error, got %v", err)
+	}
+}
+
+func TestDescribeOpenAPI(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "describe", "--format", "openapi")
+	assertCode(t, res, 0)
+	var doc struct {
+		OpenAPI string
+		Servers []struct{ URL string }
+		Paths   map[string]map[string]struct {
+			OperationID string
+			Summary     string
+			Parameters  []struct {
+				Name     string
+				In       string
+				Required bool
+				Schema   struct{ Enum []string }
+			}
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]struct{ Type, Format string }
+					}
+				}
+			}
+			Responses map[string]struct{ Description string }
+			Security  []map[string][]string
+		}
+	}
+	if err := json.Unmarshal([]byte(res.stdout), &doc); err != nil {
+		t.Fatalf("cannot parse OpenAPI document: %v\n%s", err, res.stdout)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Servers) != 1 || doc.Servers[0].URL != srv.URL+"/api/1.0" {
+		t.Fatalf("unexpected document: %+v", doc)
+	}
+
+	for path := range doc.Paths {
+		if strings.Contains(path, "?") {
+			t.Errorf("unexpected query in path %q", path)
+		}
+	}
+	// Release and reserve share a path and method, so they are merged.
+	post := doc.Paths["/ipaddresses/"]["post"]
+	if post.OperationID != "IPAddressesPost" || post.Summary != "POST actions of IPAddressesHandler, selected by op." {
+		t.Fatalf("unexpected POST operation: %+v", post)
+	}
+	if p := post.Parameters; len(p) != 1 || p[0].Name != "op" || p[0].In != "query" || !p[0].Required || strings.Join(p[0].Schema.Enum, " ") != "release reserve" {
+		t.Fatalf("unexpected POST parameters: %+v", p)
+	}
+	form := post.RequestBody.Content["application/x-www-form-urlencoded"].Schema.Properties
+	if len(form) != 3 || form["network"].Type != "string" || form["ip"].Type != "string" {
+		t.Fatalf("unexpected POST form: %+v", form)
+	}
+	if r := post.Responses; r["409"].Description != "op=reserve: if the requested address is already allocated." || r["200"].Description != "Success." {
+		t.Fatalf("unexpected POST responses: %+v", r)
+	}
+	if s := post.Security; len(s) != 1 || s[0]["maasOAuth"] == nil {
+		t.Fatalf("unexpected POST security: %+v", s)
+	}
+
+	newNIC := doc.Paths["/nodegroups/{uuid}/interfaces/"]["post"]
+	if newNIC.OperationID != "NodeGroupInterfacesNew" {
+		t.Fatalf("unexpected new interface operation: %+v", newNIC)
+	}
+	if p := newNIC.Parameters; len(p) != 2 || p[0].Name != "uuid" || p[0].In != "path" || p[1].Schema.Enum[0] != "new" {
+		t.Fatalf("unexpected new interface parameters: %+v", p)
+	}
+	if f := newNIC.RequestBody.Content["application/x-www-form-urlencoded"].Schema.Properties["ip"].Format; f != "ip" {
+		t.Fatalf("unexpected ip format: %q", f)
+	}
+	if p := doc.Paths["/ipaddresses/"]["get"].Parameters; len(p) != 0 {
+		t.Fatalf("unexpected GET /ipaddresses/ parameters: %+v", p)
+	}
+	// Node groups can be listed with or without authentication.
+	if s := doc.Paths["/nodegroups/"]["get"].Security; len(s) != 2 || len(s[0]) != 0 {
+		t.Fatalf("unexpected node groups list security: %+v", s)
+	}
+	if s := doc.Paths["/describe/"]["get"].Security; s == nil || len(s) != 0 {
+		t.Fatalf("unexpected describe security: %+v", s)
+	}
+
+	res = run(t, srv, "describe", "--format", "yaml")
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, `unsupported format "yaml" (expected one of: openapi, markdown, html)`)
+}
+
+func TestDescribeReference(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "describe", "--format", "markdown")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"# MAAS API reference\n",
+		"- [IPAddressesHandler](#ipaddresseshandler)\n  - [read](#ipaddresseshandler-read)\n",
+		"  - [list (anonymous)](#anonnodegroupshandler-list)\n",
+		"<a id=\"ipaddresseshandler-reserve\"></a>\n#### reserve\n\n`POST /ipaddresses/?op=reserve`\n",
+		"| Param | Type | Go type | Description |\n|-------|------|---------|-------------|\n"+
+			"| network | unicode | string | CIDR representation of the network on which the IP reservation is required. e.g. 10.1.2.0/24 |\n",
+		"- **400** if there is a problem with the supplied parameters.\n- **403** if",
+		"Path: `/api/1.0/nodegroups/{uuid}/interfaces/` (params: uuid)",
+	)
+	if strings.Index(res.stdout, "## DescribeHandler") > strings.Index(res.stdout, "## IPAddressesHandler") {
+		t.Errorf("expected resources sorted by name")
+	}
+
+	res = run(t, srv, "describe", "--format", "html")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout,
+		"<!DOCTYPE html>",
+		`<li><a href="#ipaddresseshandler-reserve">reserve</a></li>`,
+		`<h4 id="ipaddresseshandler-reserve">reserve</h4>`,
+		"<tr><td>ip</td><td>unicode (IP Address)</td><td>net.IP</td><td>Static IP of the interface.</td></tr>",
+		"<li><b>409</b> if the requested address is already allocated.</li>",
+		"interface&#39;s static IP address range.",
+	)
+}
+
+func TestDescribeSorted(t *testing.T) {
+	srv := newServer(t)
+	first := run(t, srv, "describe")
+	assertCode(t, first, 0)
+	assertContains(t, first.stdout, `"network":`)
+	if i, j := strings.Index(first.stdout, `"network":`), strings.Index(first.stdout, `"requested_address":`); i > j {
+		t.Errorf("expected params sorted by name, got:\n%s", first.stdout)
+	}
+	if i, j := strings.Index(first.stdout, "400: "), strings.Index(first.stdout, "503: "); i > j {
+		t.Errorf("expected return codes in order, got:\n%s", first.stdout)
+	}
+	for i := 0; i < 5; i++ {
+		if res := run(t, srv, "describe"); res.stdout != first.stdout {
+			t.Fatalf("describe output changed between runs:\n%s\nvs.\n%s", first.stdout, res.stdout)
+		}
+	}
+}
+
+func TestDescribeSearch(t *testing.T) {
+	srv := newServer(t)
+	for _, test := range []struct {
+		args       []string
+		expected   []string
+		unexpected []string
+	}{{
+		args:       []string{"--search", "Requested_Address"},
+		expected:   []string{`"IPAddressesHandler" (Auth):`, `Name: "reserve"`, `Path: "/api/1.0/ipaddresses/"`},
+		unexpected: []string{`Name: "release"`, "NetworksHandler"},
+	}, {
+		args:       []string{"--search", "static_ip_range_low"},
+		expected:   []string{`"NodeGroupInterfacesHandler" (Auth):`, `Name: "new"`, `Path: "/api/1.0/nodegroups/{uuid}/interfaces/"`},
+		unexpected: []string{`Name: "list"`, "NodeGroupInterfaceHandler"},
+	}, {
+		args:       []string{"--method", "post", "--resource", "networks"},
+		expected:   []string{`"NetworksHandler" (Auth):`, `Name: "create"`},
+		unexpected: []string{`Name: "read"`, "NetworkHandler", "IPAddressesHandler"},
+	}, {
+		args:       []string{"--resource", "nodegroups"},
+		expected:   []string{"AnonNodeGroupsHandler", `"NodeGroupsHandler" (Auth):`, "NodeGroupInterfacesHandler", "NodeGroupInterfaceHandler"},
+		unexpected: []string{"IPAddressesHandler", "NetworksHandler"},
+	}, {
+		args:       []string{"--resource", "NodeGroupInterface", "--search", "interface"},
+		expected:   []string{"NodeGroupInterfaceHandler", `Name: "update"`},
+		unexpected: []string{"NodeGroupInterfacesHandler"},
+	}} {
+		res := run(t, srv, append([]string{"describe"}, test.args...)...)
+		assertCode(t, res, 0)
+		assertContains(t, res.stdout, test.expected...)
+		for _, unexp := range test.unexpected {
+			if strings.Contains(res.stdout, unexp) {
+				t.Errorf("describe %v: expected output not to contain %q, got:\n%s", test.args, unexp, res.stdout)
+			}
+		}
+	}
+
+	// Filters apply to the other formats too.
+	res := run(t, srv, "describe", "--format", "openapi", "--search", "vlan_tag")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `"/networks/"`)
+	if strings.Contains(res.stdout, `"/ipaddresses/?op=reserve"`) {
+		t.Errorf("expected only matching paths, got:\n%s", res.stdout)
+	}
+
+	res = run(t, srv, "-d", "describe", "--search", "reserve")
+	assertCode(t, res, 0)
+	assertContains(t, res.stdout, `Name: "reserve"`)
+
+	res = run(t, srv, "describe", "--search", "mac_address")
+	assertCode(t, res, 1)
+	assertContains(t, res.stderr, "no actions match.")
+}
+
+func TestDescribeDiff(t *testing.T) {
+	srv := newServer(t)
+	res := run(t, srv, "-d", "describe")
+	assertCode(t, res, 0)
+	oldJSON := res.stdout
+	var desc struct{ Hash string }
+	if err := json.Unmarshal([]byte(oldJSON), &desc); err != nil {
+		t.Fatal(err)
+	}
+	newJSON := strings.NewReplacer(
+		desc.Hash, "new-hash",
+		`\nReturns 503 if there are no more IP addresses available.`, "",
+		`:type ip: unicode\n\nReturns 404`, `:type ip: unicode\n\n:param force: Release even if in use.\n:type force: bool\n\nReturns 404`,
+		"networks/{name}/", "networks/{id}/",
+	).Replace(oldJSON)
+	if newJSON == oldJSON {
+		t.Fatalf("new description unchanged")
+	}
+
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")
+	if err := ioutil.WriteFile(oldPath, []byte(oldJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(newPath, []byte(newJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No MAAS server is needed.
+	cmd := exec.Command(os.Args[0], "describe-diff", oldPath, newPath)
+	cmd.Env = append(os.Environ(), envRunMain+"=1", envServerURL+"=", envOAuthKey+"=")
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit code 1, got %v", err)
+	}
+	expected := strings.Join([]string{
+		"param-added ipaddresses/ release force",
+		"returns-changed ipaddresses/ reserve: removed 503",
+		"resource-added networks/{id}/",
+		"resource-removed networks/{name}/",
+	}, "\n") + "\n"
+	if string(out) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	res = run(t, srv, "--format", "json", "describe-diff", newPath, oldPath)
+	assertCode(t, res, 1)
+	assertContains(t, res.stderr, "found 4 differences (hash "+desc.Hash+", was new-hash)")
+	var changes []maas.APIChange
+	if err := json.Unmarshal([]byte(res.stdout), &changes); err != nil {
+		t.Fatalf("cannot parse changes: %v\n%s", err, res.stdout)
+	}
+	if len(changes) != 4 || changes[0].Type != maas.ParamRemoved || changes[1].Detail != "added 503" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+
+	res = run(t, srv, "describe-diff", oldPath, oldPath)
+	assertCode(t, res, 0)
+	assertContains(t, res.stderr, "API descriptions are identical (hash "+desc.Hash+").")
+
+	res = run(t, srv, "describe-diff", oldPath)
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "old and new API description files not specified.")
+	res = run(t, srv, "describe-diff", oldPath, filepath.Join(dir, "missing.json"))
+	assertCode(t, res, 2)
+	assertContains(t, res.stderr, "cannot read API description")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+var (
+	poolLabels = []string{"network", "cluster", "interface"}
+
+	staticPoolSizeDesc = prometheus.NewDesc(
+		"maas_static_pool_size",
+		"Number of addresses in the static range of the interface matching the network.",
+		poolLabels, nil,
+	)
+	staticPoolFreeDesc = prometheus.NewDesc(
+		"maas_static_pool_free",
+		"Number of unallocated addresses in the static range of the interface matching the network.",
+		poolLabels, nil,
+	)
+	allocatedDesc = prometheus.NewDesc(
+		"maas_static_ips_allocated",
+		"Number of static IPs allocated within the network, by allocation type.",
+		append(poolLabels, "alloc_type"), nil,
+	)
+	dhcpRangeSizeDesc = prometheus.NewDesc(
+		"maas_dhcp_range_size",
+		"Number of addresses in the DHCP range of the interface matching the network.",
+		poolLabels, nil,
+	)
+	scrapeErrorsDesc = prometheus.NewDesc(
+		"maas_scrape_errors_total",
+		"Number of failed refreshes of the MAAS state.",
+		nil, nil,
+	)
+	lastScrapeDesc = prometheus.NewDesc(
+		"maas_last_scrape_timestamp_seconds",
+		"Time of the last successful refresh of the MAAS state.",
+		nil, nil,
+	)
+)
+
+// poolCollector exposes the usage of the static IP pools of all networks,
+// as of the last refresh.
+type poolCollector struct {
+	client *maas.Client
+
+	mu           sync.Mutex
+	pools        []maas.PoolUsage
+	scrapeErrors int
+	lastScrape   time.Time
+}
+
+// refresh gets the current usage of all pools from MAAS.
+func (c *poolCollector) refresh() {
+	pools, err := c.getPools()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		logf("cannot refresh metrics: %v", err)
+		c.scrapeErrors++
+		return
+	}
+	c.pools, c.lastScrape = pools, time.Now()
+	debugf("refreshed metrics of %d networks", len(pools))
+}
+
+func (c *poolCollector) getPools() ([]maas.PoolUsage, error) {
+	networks, err := c.client.GetNetworks()
+	if err != nil {
+		return nil, err
+	}
+	// Like getAllNICs, but without exiting on errors, so the next refresh
+	// can still succeed.
+	nics, err := c.client.GetAllNICs()
+	if err != nil {
+		return nil, err
+	}
+	ips, err := c.client.GetIPs()
+	if err != nil {
+		return nil, err
+	}
+	var pools []maas.PoolUsage
+	for _, nw := range sortedNetworks(networks) {
+		pool, err := maas.NetworkUsage(nw, nics, ips)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		staticPoolSizeDesc, staticPoolFreeDesc, allocatedDesc, dhcpRangeSizeDesc, scrapeErrorsDesc, lastScrapeDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pool := range c.pools {
+		labels := []string{pool.Network, pool.ClusterID, pool.Interface}
+		gauge := func(desc *prometheus.Desc, value float64, extraLabels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, append(labels, extraLabels...)...)
+		}
+		size, _ := new(big.Float).SetInt(pool.StaticSize).Float64()
+		free, _ := new(big.Float).SetInt(pool.Free).Float64()
+		dhcpSize, _ := new(big.Float).SetInt(pool.DHCPSize).Float64()
+		gauge(staticPoolSizeDesc, size)
+		gauge(staticPoolFreeDesc, free)
+		gauge(dhcpRangeSizeDesc, dhcpSize)
+		// Emit all known allocation types, so their series do not vanish
+		// when no IPs of a type are left.
+		for _, allocType := range maas.AllocationTypes {
+			gauge(allocatedDesc, float64(pool.Allocated[allocType.String()]), allocType.String())
+		}
+		for allocType, count := range pool.Allocated {
+			if _, err := maas.ParseAllocationType(allocType); err != nil {
+				gauge(allocatedDesc, float64(count), allocType)
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeErrorsDesc, prometheus.CounterValue, float64(c.scrapeErrors))
+	if !c.lastScrape.IsZero() {
+		ch <- prometheus.MustNewConstMetric(lastScrapeDesc, prometheus.GaugeValue, float64(c.lastScrape.UnixNano())/1e9)
+	}
+}
+
+func serveMetrics(client *maas.Client) {
+	if metricsInterval <= 0 {
+		fatalf("invalid --interval %v: expected a positive duration", metricsInterval)
+	}
+	collector := &poolCollector{client: client}
+	collector.refresh()
+	go func() {
+		for range time.Tick(metricsInterval) {
+			collector.refresh()
+		}
+	}()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	logf("serving metrics on %s/metrics, refreshed every %v", metricsListen, metricsInterval)
+	fatalf("%v", http.ListenAndServe(metricsListen, mux))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+// Supported values of the --format flag.
+const (
+	formatJSON    = "json"
+	formatYAML    = "yaml"
+	formatTabular = "tabular"
+
+	// Only supported by describe.
+	formatOpenAPI  = "openapi"
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+)
+
+// checkFormat verifies the --format flag value is one of the given formats
+// (or empty). Without formats, --format is rejected, for commands which
+// ignore it.
+func checkFormat(formats ...string) {
+	if *format == "" {
+		return
+	}
+	if len(formats) == 0 {
+		fatalf("--format is not supported by %s", flag.Arg(0))
+	}
+	for _, f := range formats {
+		if *format == f {
+			return
+		}
+	}
+	fatalf("unsupported format %q (expected one of: %s)", *format, strings.Join(formats, ", "))
+}
+
+// printResults prints results (a slice) in the format selected with
+// --format, or renders each result with --template. For tabular output,
+// columns is used as header and rows as the table contents. Without
+// --format, goStrings are printed, separated by blank lines.
+func printResults(results interface{}, columns []string, rows [][]string, goStrings []string) {
+	if outputTemplate != nil {
+		// Pass pointers, so methods like Interface.HasStaticRange() can be
+		// used in the template.
+		entries := reflect.ValueOf(results)
+		for i := 0; i < entries.Len(); i++ {
+			executeTemplate(entries.Index(i).Addr().Interface())
+		}
+		return
+	}
+
+	switch *format {
+	case formatJSON, formatYAML:
+		printMarshalled(results)
+	case formatTabular:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(columns, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+	default:
+		for _, s := range goStrings {
+			fmt.Printf("%s\n\n", s)
+		}
+	}
+}
+
+// printMarshalled prints v as JSON or YAML, as selected with --format.
+func printMarshalled(v interface{}) {
+	if *format == formatYAML {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			fatalf("cannot marshal YAML: %v", err)
+		}
+		fmt.Print(string(data))
+		return
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fatalf("cannot marshal JSON: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+// formatRange returns "low-high", or "-" if either bound is empty.
+func formatRange(low, high fmt.Stringer) string {
+	l, h := low.String(), high.String()
+	if l == "" || h == "" {
+		return "-"
+	}
+	return l + "-" + h
+}
+
+// orDash returns s, or "-" if s is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printDryRunCall prints the given call, which --dry-run prevents from
+// being made.
+func printDryRunCall(call maas.Call) {
+	fmt.Println(call)
+}
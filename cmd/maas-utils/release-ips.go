@@ -1,33 +1,229 @@
 package main
 
 import (
-	"net/url"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
 
-	"github.com/juju/gomaasapi"
+	"github.com/dimitern/go-tools/maas"
 )
 
-func releaseIPs(maasRoot *gomaasapi.MAASObject) {
-	var released, failed int
-	allIPs := getIPs(maasRoot)
-	ips := maasRoot.GetSubObject("ipaddresses")
-	for _, ip := range allIPs {
-		debugf("trying to release %q", ip.IP)
+// releaseFilter selects which static IPs release-ips releases. All set
+// fields must match.
+type releaseFilter struct {
+	ips       map[string]bool
+	ipNets    []net.IPNet
+	allocType *maas.AllocationType
+	olderThan time.Duration
+	now       time.Time
+}
 
-		params := make(url.Values)
-		params.Set("ip", ip.IP.String())
-		result, err := ips.CallPost("release", params)
+// newReleaseFilter creates a releaseFilter from the release-ips arguments
+// and flags.
+func newReleaseFilter(client *maas.Client, args []string) releaseFilter {
+	filter := releaseFilter{now: time.Now(), olderThan: releaseOlderThan}
+	if len(args) > 0 {
+		filter.ips = make(map[string]bool)
+		for _, arg := range args {
+			ip := net.ParseIP(arg)
+			if ip == nil {
+				fatalf("invalid IP address to release: %v", arg)
+			}
+			filter.ips[ip.String()] = true
+		}
+	}
+	if releaseCIDR != "" {
+		_, ipNet, err := net.ParseCIDR(releaseCIDR)
 		if err != nil {
-			logf("cannot release %q: %v", ip.IP, err)
-			failed++
-			continue
+			fatalf("invalid --cidr: %v", err)
+		}
+		filter.ipNets = append(filter.ipNets, *ipNet)
+	}
+	if releaseNetwork != "" {
+		nw, ok := getNetworks(client)[releaseNetwork]
+		if !ok {
+			fatalf("unknown network %q", releaseNetwork)
+		}
+		ipNet, err := nw.IPNet()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		filter.ipNets = append(filter.ipNets, ipNet)
+	}
+	if releaseAllocType != "" {
+		allocType, err := maas.ParseAllocationType(releaseAllocType)
+		if err != nil {
+			fatalf("invalid --alloc-type: %v", err)
+		}
+		filter.allocType = &allocType
+	}
+	if releaseWorkers < 1 {
+		fatalf("invalid --workers %d: expected at least 1", releaseWorkers)
+	}
+	if releaseRate < 0 || math.IsNaN(releaseRate) {
+		fatalf("invalid --rate %v: expected a positive number", releaseRate)
+	}
+	if releaseOlderThan < 0 {
+		fatalf("invalid --older-than %v: expected a positive duration", releaseOlderThan)
+	}
+	return filter
+}
+
+// matches returns whether ip passes the filter.
+func (f releaseFilter) matches(ip maas.StaticIP) bool {
+	if f.ips != nil && !f.ips[ip.IP.String()] {
+		return false
+	}
+	for _, ipNet := range f.ipNets {
+		if !ipNet.Contains(ip.IP.IP) {
+			return false
 		}
-		released++
-		debugf("result was %v", result)
-		logf("IP %q released.", ip.IP)
 	}
-	if len(allIPs) > 0 {
-		logf("%d IPs successfully released; %d failures", released, failed)
+	if f.allocType != nil && ip.AllocType != *f.allocType {
+		return false
+	}
+	if f.olderThan > 0 && f.now.Sub(ip.Created) <= f.olderThan {
+		return false
+	}
+	return true
+}
+
+func releaseIPs(client *maas.Client, args []string) {
+	filter := newReleaseFilter(client, args)
+	allIPs := getIPs(client)
+	var toRelease []maas.StaticIP
+	found := make(map[string]bool)
+	for _, ip := range allIPs {
+		if filter.matches(ip) {
+			toRelease = append(toRelease, ip)
+			found[ip.IP.String()] = true
+		}
+	}
+	for _, arg := range args {
+		if ip := net.ParseIP(arg); !found[ip.String()] {
+			logf("IP %q not found among the allocated IPs matching the filters, skipping.", arg)
+		}
+	}
+	if len(toRelease) == 0 {
+		logf("no allocated IPs to release.")
 		return
 	}
-	logf("no allocated IPs to release.")
+
+	logf("%d of %d allocated IPs will be released:", len(toRelease), len(allIPs))
+	for _, ip := range toRelease {
+		logf("  %s (%s, created %s)", ip.IP, ip.AllocType, ip.Created.UTC().Format(time.RFC3339))
+	}
+	if dryRun {
+		for _, ip := range toRelease {
+			printDryRunCall(client.ReleaseIPCall(ip.IP.String()))
+		}
+		logf("dry run: no IPs released.")
+		return
+	}
+	if !confirm("Release %d IPs?", len(toRelease)) {
+		fatalf("aborted, no IPs released.")
+	}
+
+	errs := releaseConcurrently(client, toRelease, releaseWorkers, releaseRate)
+	var summary releaseSummary
+	for i, ip := range toRelease {
+		if errs[i] == nil {
+			summary.Released = append(summary.Released, ip.IP.String())
+			continue
+		}
+		summary.Failed = append(summary.Failed, releaseFailure{
+			IP:         ip.IP.String(),
+			Error:      errs[i].Error(),
+			StatusCode: maas.StatusCode(errs[i]),
+		})
+	}
+	logf("%d IPs successfully released; %d failures", len(summary.Released), len(summary.Failed))
+	if *format != "" {
+		printReleaseSummary(summary)
+	}
+	if len(summary.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// releaseConcurrently releases the given IPs using up to workers concurrent
+// API calls, starting at most rate releases per second (or without limit
+// when rate is 0). The returned errors correspond to ips.
+func releaseConcurrently(client *maas.Client, ips []maas.StaticIP, workers int, rate float64) []error {
+	errs := make([]error, len(ips))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				ip := ips[i].IP.String()
+				debugf("trying to release %q", ip)
+				if errs[i] = client.ReleaseIP(ip); errs[i] != nil {
+					logf("%v", errs[i])
+					continue
+				}
+				logf("IP %q released.", ip)
+			}
+		}()
+	}
+
+	var throttle <-chan time.Time
+	// Rates above one release per nanosecond are as good as unlimited.
+	if interval := time.Duration(float64(time.Second) / rate); rate > 0 && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	for i := range ips {
+		if throttle != nil && i > 0 {
+			<-throttle
+		}
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return errs
+}
+
+// releaseFailure describes an IP release-ips failed to release.
+type releaseFailure struct {
+	IP         string `json:"ip" yaml:"ip"`
+	Error      string `json:"error" yaml:"error"`
+	StatusCode int    `json:"status_code,omitempty" yaml:"status_code,omitempty"`
+}
+
+// releaseSummary holds the outcome of release-ips.
+type releaseSummary struct {
+	Released []string         `json:"released" yaml:"released"`
+	Failed   []releaseFailure `json:"failed" yaml:"failed"`
+}
+
+// printReleaseSummary prints summary in the format selected with --format.
+func printReleaseSummary(summary releaseSummary) {
+	if summary.Released == nil {
+		summary.Released = []string{}
+	}
+	if summary.Failed == nil {
+		summary.Failed = []releaseFailure{}
+	}
+	switch *format {
+	case formatJSON, formatYAML:
+		printMarshalled(summary)
+	case formatTabular:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "IP\tRESULT\tERROR")
+		for _, ip := range summary.Released {
+			fmt.Fprintf(tw, "%s\treleased\t-\n", ip)
+		}
+		for _, f := range summary.Failed {
+			fmt.Fprintf(tw, "%s\tfailed\t%s\n", f.IP, f.Error)
+		}
+		tw.Flush()
+	}
 }
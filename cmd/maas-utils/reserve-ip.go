@@ -1,145 +1,268 @@
 package main
 
 import (
-	"encoding/json"
+	"fmt"
+	"math/big"
 	"math/rand"
 	"net"
-	"net/url"
+	"net/http"
 	"time"
 
-	"github.com/juju/gomaasapi"
+	"github.com/dimitern/go-tools/maas"
 )
 
-func reserveIP(maasRoot *gomaasapi.MAASObject, netName, ipAddr string) {
+func reserveIP(client *maas.Client, netName, ipAddr string) {
 	if netName == "" {
 		fatalf("network name is required but missing")
 	}
+	if reserveCount < 1 {
+		fatalf("invalid --count %d: expected at least 1", reserveCount)
+	}
+	strategy, pickFree := freeIPStrategy(ipAddr)
+	explicitIP := ipAddr != "" && !pickFree
+	if explicitIP && reserveCount > 1 && !reserveContiguous {
+		fatalf("cannot reserve %d times the same IP address %q; use --contiguous to reserve a block starting with it", reserveCount, ipAddr)
+	}
+
 	debugf("listing all networks")
-	networks := getNetworks(maasRoot)
+	networks := getNetworks(client)
 	nw, ok := networks[netName]
 	if !ok {
 		fatalf("unknown network %q", netName)
 	}
-	netIP := net.ParseIP(nw.IP.String())
-	if netIP == nil {
-		fatalf("unexpected address format %v for network %q", nw.IP, netName)
+	ipNet, err := nw.IPNet()
+	if err != nil {
+		fatalf("%v", err)
 	}
-	ipNet := net.IPNet{IP: netIP, Mask: nw.Netmask}
 	debugf("trying to use network %q, finding static range", netName)
 
-	if ipAddr != "" && ipAddr != "random" {
-		ip := net.ParseIP(ipAddr)
-		if ip == nil {
+	var startIP net.IP
+	if explicitIP {
+		startIP = net.ParseIP(ipAddr)
+		if startIP == nil {
 			fatalf("invalid IP address to reserve on network %q: %v", netName, ipAddr)
 		}
-		if !ipNet.Contains(ip) {
+		if !ipNet.Contains(startIP) {
 			fatalf("IP address %q not within network %q range %q", ipAddr, netName, ipNet.String())
 		}
 	}
-	ngUUIDs := getNodeGroupsUUIDs(maasRoot)
-	if len(ngUUIDs) == 0 {
-		fatalf("no node groups defined")
+	debugf("matching network %q to node group interfaces", netName)
+	foundNIC, err := client.FindNIC(nw)
+	if err != nil {
+		fatalf("%v", err)
 	}
-	debugf("got all node groups UUIDs: %v; matching by network", ngUUIDs)
-	var foundNIC Interface
-	for _, uuid := range ngUUIDs {
-		nics := getNICs(maasRoot, uuid)
-		if len(nics) == 0 {
-			debugf("skipping node group %q - no interfaces")
-			continue
-		}
-		for _, nic := range nics {
-			ip := nic.RouterIP.String()
-			nicIP := net.ParseIP(ip)
-			if nicIP == nil {
-				debugf(
-					"skipping interface %q on node group %q - unexpected IP %v",
-					nic.Name, uuid, ip,
-				)
-				continue
-			}
-			if !ipNet.Contains(nicIP) {
-				debugf(
-					"skipping interface %q on node group %q - IP %q not within network %q range",
-					nic.Name, uuid, nicIP, netName,
-				)
-				continue
-			}
-			if !nic.HasStaticRange() {
-				fatalf(
-					"interface %q on node group %q matches network %q but has no static range",
-					nic.Name, uuid, netName,
-				)
-			}
-			// Found it
-			debugf("matched network %q to interface %q on node group %q", netName, nic.Name, uuid)
-			foundNIC = nic
-			break
-		}
+	if !foundNIC.HasStaticRange() {
+		fatalf(
+			"interface %q on node group %q matches network %q but has no static range",
+			foundNIC.Name, foundNIC.ClusterID, netName,
+		)
 	}
+	debugf("matched network %q to interface %q on node group %q", netName, foundNIC.Name, foundNIC.ClusterID)
 
-	if foundNIC.Name == "" {
-		fatalf("cannot find any node group interfaces matching network %q", netName)
+	r := &reservation{
+		client:  client,
+		ipNet:   ipNet,
+		nic:     foundNIC,
+		netName: netName,
+	}
+	if pickFree || reserveContiguous {
+		for _, ip := range getIPs(client) {
+			r.allocated = append(r.allocated, ip.IP.IP)
+		}
 	}
 
-	var ipArg string
-	switch ipAddr {
-	case "":
-		logf("trying to reserve an IP address on network %q", netName)
-	case "random":
-		ip := foundNIC.StaticRangeLowIP.IP
-		decLow, err := IPv4ToDecimal(ip)
-		if err != nil {
-			fatalf("cannot convert static range lower bound %q to decimal: %v", ip, err)
+	switch {
+	case reserveContiguous:
+		if !pickFree {
+			strategy = maas.FirstFree
 		}
-		ip = foundNIC.StaticRangeHighIP.IP
-		decHigh, err := IPv4ToDecimal(ip)
-		if err != nil {
-			fatalf("cannot convert static range higher bound %q to decimal: %v", ip, err)
+		err = r.reserveBlock(startIP, strategy)
+	case pickFree:
+		for i := 0; i < reserveCount && err == nil; i++ {
+			err = r.reserveFree(strategy)
 		}
-		totalAddressesInRange := decHigh - decLow
-		newDecimal := decLow + uint32(random.Intn(int(totalAddressesInRange)))
-		newIP := DecimalToIPv4(newDecimal)
-		if newIP == nil {
-			fatalf("generated random IP %v is invalid", newIP)
+	case ipAddr == "":
+		for i := 0; i < reserveCount && err == nil; i++ {
+			logf("trying to reserve an IP address on network %q", netName)
+			_, err = r.reserve("")
 		}
-		ipArg = newIP.String()
-		logf("trying to reserve a random IP address (%q) on network %q", ipArg, netName)
 	default:
-		ipArg = ipAddr
 		logf("trying to reserve IP address %q on network %q", ipAddr, netName)
+		_, err = r.reserve(ipAddr)
+	}
+	if err != nil {
+		r.rollback()
+		fatalf("%v", err)
+	}
+	if dryRun {
+		logf("dry run: matched network %q to interface %q on node group %q; no IPs reserved.", netName, foundNIC.Name, foundNIC.ClusterID)
+		return
+	}
+	if reserveCount > 1 {
+		logf("reserved %d IP addresses on network %q successfully.", len(r.reserved), netName)
 	}
 
-	ips := maasRoot.GetSubObject("ipaddresses")
-	params := make(url.Values)
-	params.Set("network", ipNet.String())
-	if ipArg != "" {
-		params.Set("requested_address", ipArg)
+	listIPs(client)
+}
+
+// freeIPStrategy returns the strategy for picking a free IP given as the
+// reserve-ip ip argument, and whether ipAddr was a strategy at all. The
+// "random" argument is the same as "random-free".
+func freeIPStrategy(ipAddr string) (maas.FreeIPStrategy, bool) {
+	if ipAddr == "random" {
+		return maas.RandomFree, true
 	}
-	logf("calling POST %s with op=reserve and params %v", ips.URL(), params)
-	result, err := ips.CallPost("reserve", params)
-	if err != nil {
-		fatalf("MAAS returned: %v", err)
+	for _, strategy := range maas.FreeIPStrategies {
+		if ipAddr == string(strategy) {
+			return strategy, true
+		}
 	}
-	debugf("result was %v", result)
-	data, err := result.MarshalJSON()
+	return "", false
+}
+
+// reservation holds the state of a reserve-ip batch on a network.
+type reservation struct {
+	client  *maas.Client
+	ipNet   net.IPNet
+	nic     maas.Interface
+	netName string
+
+	// allocated holds all addresses known to be allocated.
+	allocated []net.IP
+	// reserved holds the addresses reserved so far.
+	reserved []maas.StaticIP
+}
+
+// reserve reserves the given IP address on the network, or lets MAAS pick
+// one when ipAddr is empty.
+func (r *reservation) reserve(ipAddr string) (maas.StaticIP, error) {
+	call := r.client.ReserveIPCall(r.ipNet, ipAddr)
+	if dryRun {
+		printDryRunCall(call)
+		staticIP := maas.StaticIP{
+			AllocType: maas.AllocUserReserved,
+			IP:        maas.Address{IP: net.ParseIP(ipAddr), Hostname: ipAddr},
+		}
+		if ipAddr != "" {
+			r.reserved = append(r.reserved, staticIP)
+			r.allocated = append(r.allocated, staticIP.IP.IP)
+		}
+		return staticIP, nil
+	}
+	logf("calling %s", call)
+	staticIP, err := r.client.ReserveIP(r.ipNet, ipAddr)
 	if err != nil {
-		fatalf("serializing to JSON failed: %v", err)
+		return maas.StaticIP{}, err
 	}
-	var staticIP StaticIP
-	if err := json.Unmarshal(data, &staticIP); err != nil {
-		fatalf("deserializing from JSON failed: %v", err)
+	logf("allocated IP address %q on network %q successfully.", staticIP.IP, r.netName)
+	r.reserved = append(r.reserved, staticIP)
+	r.allocated = append(r.allocated, staticIP.IP.IP)
+	return staticIP, nil
+}
+
+// reserveFree picks a free IP from the static range of the network's
+// interface, based on the known allocations and the given strategy, and
+// reserves it. When MAAS reports a conflict (e.g. the address was
+// allocated in the meantime), another address is picked, up to --retries
+// times.
+func (r *reservation) reserveFree(strategy maas.FreeIPStrategy) error {
+	low, high := r.nic.StaticRangeLowIP.IP, r.nic.StaticRangeHighIP.IP
+	for attempt := 0; ; attempt++ {
+		ip, err := maas.PickFreeIP(low, high, r.allocated, strategy, random)
+		if err != nil {
+			return fmt.Errorf("cannot pick a free IP address on network %q: %v", r.netName, err)
+		}
+		logf("trying to reserve a %s IP address (%q) on network %q", strategy, ip, r.netName)
+		_, err = r.reserve(ip.String())
+		if err == nil {
+			return nil
+		}
+		if maas.StatusCode(err) != http.StatusConflict || attempt >= reserveRetries {
+			return err
+		}
+		logf("IP address %q is already in use, retrying (%d of %d)", ip, attempt+1, reserveRetries)
+		r.allocated = append(r.allocated, ip)
 	}
-	if staticIP.IP.String() != ipArg && ipArg != "" {
-		fatalf("tried to allocate %q, but MAAS returned %q", ipArg, staticIP.IP)
+}
+
+// reserveBlock reserves --count consecutive IPs from the static range of
+// the network's interface, starting with startIP, if given. Otherwise, the
+// block is picked using the given strategy, and on conflicts the partially
+// reserved block is released and another one picked, up to --retries
+// times.
+func (r *reservation) reserveBlock(startIP net.IP, strategy maas.FreeIPStrategy) error {
+	low, high := r.nic.StaticRangeLowIP.IP, r.nic.StaticRangeHighIP.IP
+	for attempt := 0; ; attempt++ {
+		first := startIP
+		if first == nil {
+			var err error
+			first, err = maas.PickFreeBlock(low, high, r.allocated, reserveCount, strategy, random)
+			if err != nil {
+				return fmt.Errorf("cannot pick %d contiguous free IP addresses on network %q: %v", reserveCount, r.netName, err)
+			}
+		}
+		last, err := maas.OffsetIP(first, big.NewInt(int64(reserveCount-1)))
+		if err != nil {
+			return err
+		}
+		inRange, err := maas.IPInRange(last, low, high)
+		if err != nil {
+			return err
+		}
+		if firstInRange, _ := maas.IPInRange(first, low, high); !inRange || !firstInRange {
+			return fmt.Errorf("IP addresses %s-%s not within the static range %s-%s of network %q", first, last, low, high, r.netName)
+		}
+		logf("trying to reserve %d contiguous IP addresses (%s-%s) on network %q", reserveCount, first, last, r.netName)
+
+		var ip net.IP
+		for i := 0; i < reserveCount && err == nil; i++ {
+			ip, err = maas.OffsetIP(first, big.NewInt(int64(i)))
+			if err == nil {
+				_, err = r.reserve(ip.String())
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if startIP != nil || maas.StatusCode(err) != http.StatusConflict || attempt >= reserveRetries {
+			return err
+		}
+		logf("IP address %q is already in use, retrying (%d of %d)", ip, attempt+1, reserveRetries)
+		r.rollback()
+		r.allocated = append(r.allocated, ip)
 	}
-	logf("allocated IP address %q on network %q successfully.", staticIP, netName)
+}
 
-	listIPs(maasRoot)
+// rollback releases all addresses reserved so far, in reverse order.
+func (r *reservation) rollback() {
+	if dryRun {
+		r.reserved = nil
+		return
+	}
+	for i := len(r.reserved) - 1; i >= 0; i-- {
+		ip := r.reserved[i].IP.String()
+		logf("rolling back: releasing IP address %q", ip)
+		if err := r.client.ReleaseIP(ip); err != nil {
+			logf("rollback failed: %v", err)
+			continue
+		}
+		for j, allocated := range r.allocated {
+			if allocated.String() == ip {
+				r.allocated = append(r.allocated[:j], r.allocated[j+1:]...)
+				break
+			}
+		}
+	}
+	r.reserved = nil
 }
 
 var random *rand.Rand
 
-func init() {
-	random = rand.New(rand.NewSource(time.Now().Unix()))
+// seedRandom seeds random with --seed, or the current time when not set.
+func seedRandom() {
+	seed := randomSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	random = rand.New(rand.NewSource(seed))
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"text/template"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+// outputTemplate is parsed from the --template flag of list commands.
+var outputTemplate *template.Template
+
+// templateFuncs are the helper functions available to --template.
+var templateFuncs = template.FuncMap{
+	"cidr":      templateCIDR,
+	"netmask":   func(mask net.IPMask) string { s, _ := maas.FormatMask(mask); return s },
+	"prefix":    func(mask net.IPMask) int { _, p := maas.FormatMask(mask); return p },
+	"ipRange":   templateIPRange,
+	"rangeSize": templateRangeSize,
+	"inRange":   templateInRange,
+}
+
+// parseTemplate parses the --template flag, if given.
+func parseTemplate() {
+	if templateText == "" {
+		return
+	}
+	if *format != "" {
+		fatalf("--template and --format cannot be used together")
+	}
+	tmpl, err := template.New("template").Funcs(templateFuncs).Parse(templateText)
+	if err != nil {
+		fatalf("invalid template: %v", err)
+	}
+	outputTemplate = tmpl
+}
+
+// executeTemplate renders the given entry with outputTemplate, followed by
+// a newline.
+func executeTemplate(entry interface{}) {
+	if err := outputTemplate.Execute(os.Stdout, entry); err != nil {
+		fatalf("cannot execute template: %v", err)
+	}
+	fmt.Println()
+}
+
+func templateCIDR(entry interface{}) (string, error) {
+	var (
+		ipNet net.IPNet
+		err   error
+	)
+	switch e := entry.(type) {
+	case *maas.Network:
+		ipNet, err = e.IPNet()
+	case maas.Network:
+		ipNet, err = e.IPNet()
+	case *maas.Interface:
+		ipNet, err = e.IPNet()
+	case maas.Interface:
+		ipNet, err = e.IPNet()
+	default:
+		return "", fmt.Errorf("cidr: expected a network or interface, got %T", entry)
+	}
+	if err != nil {
+		return "", err
+	}
+	return ipNet.String(), nil
+}
+
+func templateIPRange(low, high maas.Address) string {
+	if low.IsEmpty() || high.IsEmpty() {
+		return ""
+	}
+	return low.String() + "-" + high.String()
+}
+
+func templateRangeSize(low, high maas.Address) (*big.Int, error) {
+	return maas.IPRangeSize(low.IP, high.IP)
+}
+
+func templateInRange(ip, low, high maas.Address) (bool, error) {
+	return maas.IPInRange(ip.IP, low.IP, high.IP)
+}
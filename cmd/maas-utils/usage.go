@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+func reportUsage(client *maas.Client, netNames []string) {
+	if maxUtilization < 0 || maxUtilization > 100 {
+		fatalf("invalid --max-utilization %v: expected a percentage between 0 and 100", maxUtilization)
+	}
+	if minFree < 0 {
+		fatalf("invalid --min-free %d: expected a positive number", minFree)
+	}
+	networks := getNetworks(client)
+	selected := sortedNetworks(networks)
+	if len(netNames) > 0 {
+		selected = selected[:0]
+		for _, name := range netNames {
+			nw, ok := networks[name]
+			if !ok {
+				fatalf("unknown network %q", name)
+			}
+			selected = append(selected, nw)
+		}
+	}
+	nics := getAllNICs(client)
+	ips := getIPs(client)
+
+	pools := make([]maas.PoolUsage, len(selected))
+	rows := make([][]string, len(selected))
+	goStrings := make([]string, len(selected))
+	var exhausted int
+	for i, nw := range selected {
+		pool, err := maas.NetworkUsage(nw, nics, ips)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		pools[i] = pool
+		utilization, free := "-", "-"
+		if pool.HasStaticRange() {
+			utilization = fmt.Sprintf("%.1f%%", pool.Utilization)
+			free = pool.Free.String()
+			if poolExhausted(pool) {
+				exhausted++
+			}
+		}
+		rows[i] = []string{
+			pool.Network,
+			orDash(pool.ClusterID),
+			orDash(pool.Interface),
+			pool.StaticSize.String(),
+			orDash(formatAllocated(pool.Allocated)),
+			free,
+			pool.DHCPSize.String(),
+			utilization,
+		}
+		goStrings[i] = formatPoolUsage(pool)
+	}
+	columns := []string{"NETWORK", "CLUSTER", "INTERFACE", "STATIC SIZE", "ALLOCATED", "FREE", "DHCP SIZE", "UTILIZATION"}
+	printResults(pools, columns, rows, goStrings)
+	if exhausted > 0 {
+		logf("%d of %d static IP pools are nearly exhausted", exhausted, len(pools))
+		os.Exit(1)
+	}
+}
+
+// poolExhausted returns whether pool exceeds the --max-utilization or
+// --min-free thresholds, logging why.
+func poolExhausted(pool maas.PoolUsage) bool {
+	if maxUtilization > 0 && pool.Utilization >= maxUtilization {
+		logf("static range of network %q is %.1f%% utilized (threshold: %v%%)", pool.Network, pool.Utilization, maxUtilization)
+		return true
+	}
+	if minFree > 0 && pool.Free.Cmp(big.NewInt(minFree)) < 0 {
+		logf("static range of network %q has %s free addresses left (threshold: %d)", pool.Network, pool.Free, minFree)
+		return true
+	}
+	return false
+}
+
+// formatAllocated returns the given allocation counts as "type=count"
+// pairs, sorted by type.
+func formatAllocated(allocated map[string]int) string {
+	pairs := make([]string, 0, len(allocated))
+	for allocType, count := range allocated {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", allocType, count))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// formatPoolUsage returns a human-readable summary of pool.
+func formatPoolUsage(pool maas.PoolUsage) string {
+	var summary string
+	if pool.Interface == "" {
+		summary = fmt.Sprintf("network %q: no matching node group interface", pool.Network)
+	} else {
+		summary = fmt.Sprintf("network %q (interface %q of node group %q):", pool.Network, pool.Interface, pool.ClusterID)
+		if pool.HasStaticRange() {
+			summary += fmt.Sprintf(" %s of %s static IPs free (%.1f%% utilized),", pool.Free, pool.StaticSize, pool.Utilization)
+		} else {
+			summary += " no static range,"
+		}
+		summary += fmt.Sprintf(" %s DHCP IPs", pool.DHCPSize)
+	}
+	if len(pool.Allocated) > 0 {
+		summary += "\n  allocated: " + formatAllocated(pool.Allocated)
+	}
+	return summary
+}
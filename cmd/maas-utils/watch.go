@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+func watch(client *maas.Client) {
+	if watchInterval <= 0 {
+		fatalf("invalid --interval %v: expected a positive duration", watchInterval)
+	}
+	if watchPolls < 0 {
+		fatalf("invalid --polls %d: expected a positive number", watchPolls)
+	}
+	logf("watching static IPs and networks every %v", watchInterval)
+
+	var last *maas.Snapshot
+	for poll := 1; watchPolls == 0 || poll <= watchPolls; poll++ {
+		if poll > 1 {
+			time.Sleep(watchInterval)
+		}
+		snapshot, err := client.Snapshot()
+		if err != nil {
+			// Keep watching, the server might be restarting.
+			logf("%v", err)
+			continue
+		}
+		debugf("got %d static IPs and %d networks", len(snapshot.IPs), len(snapshot.Networks))
+		if last == nil {
+			logf("found %d static IPs and %d networks", len(snapshot.IPs), len(snapshot.Networks))
+		} else {
+			for _, event := range maas.DiffSnapshots(*last, snapshot) {
+				printEvent(event)
+			}
+		}
+		last = &snapshot
+	}
+}
+
+// printEvent prints event as a line of text, or JSON with --json.
+func printEvent(event maas.Event) {
+	if watchJSON {
+		data, err := json.Marshal(event)
+		if err != nil {
+			fatalf("cannot marshal JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	var details string
+	switch {
+	case event.IP != nil:
+		details = fmt.Sprintf("%s (%s, created %s)", event.IP.IP, event.IP.AllocType, event.IP.Created.UTC().Format(time.RFC3339))
+	case event.Network != nil:
+		ipNet, _ := event.Network.IPNet()
+		details = fmt.Sprintf("%s (%s)", event.Network.Name, ipNet.String())
+	}
+	fmt.Printf("%s %s %s\n", event.Time.UTC().Format(time.RFC3339), event.Type, details)
+}
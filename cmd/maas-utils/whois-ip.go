@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+func whoisIP(client *maas.Client, ipAddr string) {
+	if ipAddr == "" {
+		fatalf("IP address to look up not specified.")
+	}
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		fatalf("invalid IP address %q", ipAddr)
+	}
+	info, err := maas.WhoisIP(ip, getNetworks(client), getAllNICs(client), getIPs(client))
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	network, cluster, iface, allocType, created := "-", "-", "-", "-", "-"
+	lines := []string{"IP: " + ip.String()}
+	if nw := info.Network; nw != nil {
+		ipNet, _ := nw.IPNet()
+		network = nw.Name
+		lines = append(lines, fmt.Sprintf("Network: %s (%s)", nw.Name, ipNet.String()))
+	} else {
+		lines = append(lines, "Network: none")
+	}
+	if nic := info.Interface; nic != nil {
+		cluster, iface = nic.ClusterID, nic.Name
+		lines = append(lines, fmt.Sprintf("Interface: %s of node group %s (management: %s)", nic.Name, nic.ClusterID, nic.Management))
+		switch info.Range {
+		case maas.RangeStatic:
+			lines = append(lines, "Range: static ("+formatRange(nic.StaticRangeLowIP, nic.StaticRangeHighIP)+")")
+		case maas.RangeDHCP:
+			lines = append(lines, "Range: DHCP ("+formatRange(nic.DHCPRangeLowIP, nic.DHCPRangeHighIP)+")")
+		default:
+			lines = append(lines, "Range: none")
+		}
+	} else {
+		lines = append(lines, "Interface: none")
+	}
+	if alloc := info.Allocation; alloc != nil {
+		allocType, created = alloc.AllocType.String(), alloc.Created.UTC().Format(time.RFC3339)
+		lines = append(lines, fmt.Sprintf("Allocated: %s, created %s", allocType, created))
+	} else {
+		lines = append(lines, "Allocated: no")
+	}
+
+	row := []string{ip.String(), network, cluster, iface, info.Range, allocType, created}
+	columns := []string{"IP", "NETWORK", "CLUSTER", "INTERFACE", "RANGE", "ALLOC TYPE", "CREATED"}
+	printResults([]maas.IPInfo{info}, columns, [][]string{row}, []string{strings.Join(lines, "\n")})
+}
@@ -0,0 +1,209 @@
+package maas
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of APIChange.
+const (
+	ResourceAdded   = "resource-added"
+	ResourceRemoved = "resource-removed"
+	ActionAdded     = "action-added"
+	ActionRemoved   = "action-removed"
+	ActionChanged   = "action-changed"
+	ParamAdded      = "param-added"
+	ParamRemoved    = "param-removed"
+	ReturnsChanged  = "returns-changed"
+)
+
+// APIChange describes a difference between two API descriptions.
+type APIChange struct {
+	Type string `json:"type" yaml:"type"`
+	// Path is the path of the handler, relative to the API version prefix.
+	Path string `json:"path" yaml:"path"`
+	// Anon is set for changes of anonymous handlers.
+	Anon   bool   `json:"anon,omitempty" yaml:"anon,omitempty"`
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+	Param  string `json:"param,omitempty" yaml:"param,omitempty"`
+	// Detail describes changed actions and return codes.
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+func (c APIChange) String() string {
+	subject := c.Path
+	if c.Anon {
+		subject += " (anonymous)"
+	}
+	for _, s := range []string{c.Action, c.Param} {
+		if s != "" {
+			subject += " " + s
+		}
+	}
+	if c.Detail != "" {
+		return fmt.Sprintf("%s %s: %s", c.Type, subject, c.Detail)
+	}
+	return fmt.Sprintf("%s %s", c.Type, subject)
+}
+
+// handlerKey identifies a handler across API descriptions.
+type handlerKey struct {
+	path string
+	anon bool
+}
+
+// handlersByKey returns the handlers of a, keyed by their relative path
+// and whether they are anonymous.
+func (a *APIDescription) handlersByKey() map[handlerKey]*APIHandler {
+	handlers := make(map[handlerKey]*APIHandler)
+	for _, resource := range a.Resources {
+		if resource.Auth != nil {
+			handlers[handlerKey{relativePath(resource.Auth.Path), false}] = resource.Auth
+		}
+		if resource.Anon != nil {
+			handlers[handlerKey{relativePath(resource.Anon.Path), true}] = resource.Anon
+		}
+	}
+	return handlers
+}
+
+// DiffAPIDescriptions returns the resources (handlers, keyed by path),
+// actions (keyed by name), params and return codes added, removed or
+// changed from old to new, sorted by path and action. When both have the
+// same hash, they are considered equal without comparing them.
+func DiffAPIDescriptions(old, new *APIDescription) []APIChange {
+	if old.Hash != "" && old.Hash == new.Hash {
+		return nil
+	}
+	oldHandlers, newHandlers := old.handlersByKey(), new.handlersByKey()
+	keys := make(map[handlerKey]bool)
+	for key := range oldHandlers {
+		keys[key] = true
+	}
+	for key := range newHandlers {
+		keys[key] = true
+	}
+	sortedKeys := make([]handlerKey, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Slice(sortedKeys, func(i, j int) bool {
+		if sortedKeys[i].path != sortedKeys[j].path {
+			return sortedKeys[i].path < sortedKeys[j].path
+		}
+		return !sortedKeys[i].anon
+	})
+
+	var changes []APIChange
+	for _, key := range sortedKeys {
+		oldHandler, newHandler := oldHandlers[key], newHandlers[key]
+		change := APIChange{Path: key.path, Anon: key.anon}
+		switch {
+		case oldHandler == nil:
+			change.Type = ResourceAdded
+			changes = append(changes, change)
+		case newHandler == nil:
+			change.Type = ResourceRemoved
+			changes = append(changes, change)
+		default:
+			changes = append(changes, diffActions(change, oldHandler, newHandler)...)
+		}
+	}
+	return changes
+}
+
+// diffActions returns the changes of the actions of a handler, using
+// change as template.
+func diffActions(change APIChange, oldHandler, newHandler *APIHandler) []APIChange {
+	oldActions, newActions := make(map[string]APIAction), make(map[string]APIAction)
+	var names []string
+	for _, action := range oldHandler.Actions {
+		oldActions[action.Name] = action
+		names = append(names, action.Name)
+	}
+	for _, action := range newHandler.Actions {
+		newActions[action.Name] = action
+		if _, ok := oldActions[action.Name]; !ok {
+			names = append(names, action.Name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []APIChange
+	for _, name := range names {
+		oldAction, inOld := oldActions[name]
+		newAction, inNew := newActions[name]
+		change.Action = name
+		switch {
+		case !inOld:
+			change.Type = ActionAdded
+			changes = append(changes, change)
+			continue
+		case !inNew:
+			change.Type = ActionRemoved
+			changes = append(changes, change)
+			continue
+		}
+		if oldCall, newCall := actionCall(oldAction), actionCall(newAction); oldCall != newCall {
+			changes = append(changes, APIChange{
+				Type: ActionChanged, Path: change.Path, Anon: change.Anon, Action: name,
+				Detail: fmt.Sprintf("%s, was %s", newCall, oldCall),
+			})
+		}
+		for _, param := range oldAction.paramNames() {
+			if _, ok := newAction.DocParams[param]; !ok {
+				changes = append(changes, APIChange{Type: ParamRemoved, Path: change.Path, Anon: change.Anon, Action: name, Param: param})
+			}
+		}
+		for _, param := range newAction.paramNames() {
+			if _, ok := oldAction.DocParams[param]; !ok {
+				changes = append(changes, APIChange{Type: ParamAdded, Path: change.Path, Anon: change.Anon, Action: name, Param: param})
+			}
+		}
+		if detail := diffCodes(oldAction.sortedCodes(), newAction.sortedCodes()); detail != "" {
+			changes = append(changes, APIChange{Type: ReturnsChanged, Path: change.Path, Anon: change.Anon, Action: name, Detail: detail})
+		}
+	}
+	return changes
+}
+
+// actionCall returns the HTTP method and op of action, e.g. "POST op=reserve".
+func actionCall(action APIAction) string {
+	if action.Op == nil {
+		return action.Method
+	}
+	return action.Method + " op=" + *action.Op
+}
+
+// diffCodes describes the return codes added and removed from old to new,
+// or returns "" when there are none.
+func diffCodes(old, new []int) string {
+	inOld, inNew := make(map[int]bool), make(map[int]bool)
+	for _, code := range old {
+		inOld[code] = true
+	}
+	for _, code := range new {
+		inNew[code] = true
+	}
+	var added, removed []string
+	for _, code := range new {
+		if !inOld[code] {
+			added = append(added, strconv.Itoa(code))
+		}
+	}
+	for _, code := range old {
+		if !inNew[code] {
+			removed = append(removed, strconv.Itoa(code))
+		}
+	}
+	var parts []string
+	if len(added) > 0 {
+		parts = append(parts, "added "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(removed, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
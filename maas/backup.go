@@ -0,0 +1,92 @@
+package maas
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Backup holds user-reserved static IPs, so they can be reserved again,
+// e.g. after reinstalling the MAAS region controller.
+type Backup struct {
+	IPs []BackupIP `yaml:"ips"`
+}
+
+// BackupIP is a user-reserved static IP in a Backup, with the network it
+// was reserved on.
+type BackupIP struct {
+	IP      string `yaml:"ip"`
+	Network string `yaml:"network"`
+	CIDR    string `yaml:"cidr"`
+	Created string `yaml:"created,omitempty"`
+}
+
+// NewBackup returns a Backup of the user-reserved IPs among ips. Each is
+// saved with the most specific of the given networks containing it;
+// user-reserved IPs outside all networks are returned separately.
+func NewBackup(networks map[string]Network, ips []StaticIP) (Backup, []StaticIP, error) {
+	var (
+		backup  Backup
+		skipped []StaticIP
+	)
+	for _, ip := range ips {
+		if ip.AllocType != AllocUserReserved {
+			continue
+		}
+		info, err := WhoisIP(ip.IP.IP, networks, nil, nil)
+		if err != nil {
+			return Backup{}, nil, err
+		}
+		if info.Network == nil {
+			skipped = append(skipped, ip)
+			continue
+		}
+		ipNet, err := info.Network.IPNet()
+		if err != nil {
+			return Backup{}, nil, err
+		}
+		backupIP := BackupIP{
+			IP:      ip.IP.String(),
+			Network: info.Network.Name,
+			CIDR:    ipNet.String(),
+		}
+		if !ip.Created.IsZero() {
+			backupIP.Created = ip.Created.UTC().Format(time.RFC3339)
+		}
+		backup.IPs = append(backup.IPs, backupIP)
+	}
+	return backup, skipped, nil
+}
+
+// ParseBackup parses a Backup written as YAML, verifying all addresses
+// and CIDRs are valid.
+func ParseBackup(data []byte) (Backup, error) {
+	var backup Backup
+	if err := yaml.UnmarshalStrict(data, &backup); err != nil {
+		return Backup{}, fmt.Errorf("cannot parse backup: %v", err)
+	}
+	for i, ip := range backup.IPs {
+		if net.ParseIP(ip.IP) == nil {
+			return Backup{}, fmt.Errorf("invalid IP #%d: %q", i+1, ip.IP)
+		}
+		if _, _, err := net.ParseCIDR(ip.CIDR); err != nil {
+			return Backup{}, fmt.Errorf("invalid CIDR of IP %q: %v", ip.IP, err)
+		}
+	}
+	return backup, nil
+}
+
+// IPNet returns the network to reserve the IP on: the one with the saved
+// name among networks, if any, otherwise the saved CIDR.
+func (b BackupIP) IPNet(networks map[string]Network) (net.IPNet, error) {
+	if nw, ok := networks[b.Network]; ok {
+		return nw.IPNet()
+	}
+	_, ipNet, err := net.ParseCIDR(b.CIDR)
+	if err != nil {
+		return net.IPNet{}, err
+	}
+	return *ipNet, nil
+}
@@ -0,0 +1,251 @@
+package maas
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// APICache caches API descriptions on disk, keyed by server URL and hash,
+// as both the indented raw JSON and the parsed result. Parsed results are
+// also keyed by apiCacheVersion.
+type APICache struct {
+	dir string
+}
+
+// apiCacheVersion is the version of the parsed results in an APICache. It
+// must be incremented whenever ParseAPIDescription or the cached types
+// change, so that results of older versions are parsed again.
+const apiCacheVersion = 2
+
+// NewAPICache returns an APICache storing descriptions under dir.
+func NewAPICache(dir string) *APICache {
+	return &APICache{dir: dir}
+}
+
+// DefaultAPICacheDir returns the directory for an APICache under the user
+// cache dir (e.g. ~/.cache/maas-utils/api on Linux).
+func DefaultAPICacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find user cache dir: %v", err)
+	}
+	return filepath.Join(dir, "maas-utils", "api"), nil
+}
+
+// apiCacheIndex records the hash of the description last fetched from a
+// server.
+type apiCacheIndex struct {
+	ServerURL string    `json:"server_url"`
+	Hash      string    `json:"hash"`
+	Updated   time.Time `json:"updated"`
+}
+
+// cachedAPIDescription is the parsed API description, as cached. As the
+// parsed action docs are not marshalled with APIDescription, they are
+// stored in the order ParseAPIDescription parses them.
+type cachedAPIDescription struct {
+	Description *APIDescription   `json:"description"`
+	Docs        []cachedActionDoc `json:"docs"`
+}
+
+type cachedActionDoc struct {
+	Doc     string           `json:"doc"`
+	Params  []cachedParam    `json:"params,omitempty"`
+	Returns map[int][]string `json:"returns,omitempty"`
+}
+
+// cachedParam is an ActionParam, without the GoType derived from its
+// PythonType.
+type cachedParam struct {
+	Name       string `json:"name"`
+	Doc        string `json:"doc"`
+	PythonType string `json:"python_type"`
+}
+
+// GetAPIDescription is like the GetAPIDescription function, but only
+// parses the description when the cache has none with the same hash, and
+// caches the result. As MAAS provides no other way to find the hash, the
+// description is still downloaded. Failing to update the cache is not an
+// error.
+func (c *APICache) GetAPIDescription(serverURL string) (*APIDescription, string, error) {
+	data, err := fetchAPIDescription(serverURL)
+	if err != nil {
+		return nil, "", err
+	}
+	var header struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, "", fmt.Errorf("cannot unmarshal response JSON: %v", err)
+	}
+	hash := header.Hash
+	if hash == "" {
+		hash = fmt.Sprintf("%x", sha1.Sum(data))
+	}
+
+	dir := c.serverDir(serverURL)
+	apiDesc, rawJSON, err := c.load(dir, hash)
+	if err != nil {
+		if apiDesc, rawJSON, err = ParseAPIDescription(data); err != nil {
+			return nil, "", err
+		}
+		c.store(dir, hash, apiDesc, rawJSON)
+	}
+	writeJSONFile(filepath.Join(dir, "index.json"), apiCacheIndex{
+		ServerURL: serverURL,
+		Hash:      hash,
+		Updated:   time.Now().UTC(),
+	})
+	return apiDesc, rawJSON, nil
+}
+
+// CachedAPIDescription returns the API description of the server at
+// serverURL last cached by GetAPIDescription, without contacting it.
+func (c *APICache) CachedAPIDescription(serverURL string) (*APIDescription, string, error) {
+	dir := c.serverDir(serverURL)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("no cached API description of %q", serverURL)
+	} else if err != nil {
+		return nil, "", fmt.Errorf("cannot read API description cache: %v", err)
+	}
+	var index apiCacheIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, "", fmt.Errorf("cannot read API description cache: %v", err)
+	}
+	return c.load(dir, index.Hash)
+}
+
+// serverDir returns the cache directory of the server at serverURL.
+func (c *APICache) serverDir(serverURL string) string {
+	key := sha1.Sum([]byte(strings.TrimSuffix(serverURL, "/")))
+	return filepath.Join(c.dir, fmt.Sprintf("%x", key))
+}
+
+var safeFileName = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// cacheFile returns the path of the cached file with the given extension
+// for hash.
+func cacheFile(dir, hash, ext string) string {
+	if !safeFileName.MatchString(hash) {
+		hash = fmt.Sprintf("%x", sha1.Sum([]byte(hash)))
+	}
+	return filepath.Join(dir, hash+ext)
+}
+
+// parsedCacheFile returns the path of the parsed result cached for hash.
+func parsedCacheFile(dir, hash string) string {
+	return cacheFile(dir, hash, fmt.Sprintf(".parsed-v%d.json", apiCacheVersion))
+}
+
+// load returns the cached description with the given hash, and its raw
+// JSON.
+func (c *APICache) load(dir, hash string) (*APIDescription, string, error) {
+	rawJSON, err := ioutil.ReadFile(cacheFile(dir, hash, ".json"))
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot read cached API description: %v", err)
+	}
+	data, err := ioutil.ReadFile(parsedCacheFile(dir, hash))
+	if err != nil {
+		// Parse the raw JSON instead.
+		return ParseAPIDescription(rawJSON)
+	}
+	var cached cachedAPIDescription
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Description == nil {
+		return ParseAPIDescription(rawJSON)
+	}
+
+	docs := cached.Docs
+	for _, handler := range cached.Description.handlers() {
+		for i := range handler.Actions {
+			if len(docs) == 0 {
+				return ParseAPIDescription(rawJSON)
+			}
+			action, doc := &handler.Actions[i], docs[0]
+			docs = docs[1:]
+			action.Doc, action.DocReturns = doc.Doc, doc.Returns
+			for _, param := range doc.Params {
+				if action.DocParams == nil {
+					action.DocParams = make(map[string]ActionParam)
+				}
+				action.DocParams[param.Name] = ActionParam{
+					Name:       param.Name,
+					Doc:        param.Doc,
+					PythonType: param.PythonType,
+					GoType:     deriveGoTypeFromPythonType(param.PythonType),
+				}
+			}
+		}
+	}
+	return cached.Description, string(rawJSON), nil
+}
+
+// store caches the given description and its raw JSON with hash.
+func (c *APICache) store(dir, hash string, apiDesc *APIDescription, rawJSON string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	cached := cachedAPIDescription{Description: apiDesc}
+	for _, handler := range apiDesc.handlers() {
+		for _, action := range handler.Actions {
+			doc := cachedActionDoc{Doc: action.Doc, Returns: action.DocReturns}
+			for _, name := range action.paramNames() {
+				param := action.DocParams[name]
+				doc.Params = append(doc.Params, cachedParam{Name: param.Name, Doc: param.Doc, PythonType: param.PythonType})
+			}
+			cached.Docs = append(cached.Docs, doc)
+		}
+	}
+	if writeFile(cacheFile(dir, hash, ".json"), []byte(rawJSON)) == nil {
+		writeJSONFile(parsedCacheFile(dir, hash), cached)
+	}
+}
+
+// handlers returns the handlers of a, in the order ParseAPIDescription
+// parses them.
+func (a *APIDescription) handlers() []*APIHandler {
+	var handlers []*APIHandler
+	for _, resource := range a.Resources {
+		for _, handler := range []*APIHandler{resource.Anon, resource.Auth} {
+			if handler != nil {
+				handlers = append(handlers, handler)
+			}
+		}
+	}
+	return handlers
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// writeFile atomically replaces the file at path with data.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,68 @@
+package maas
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const cacheTestDescription = `{
+  "doc": "MAAS API",
+  "hash": "abc123",
+  "resources": [{
+    "name": "VersionHandler",
+    "anon": {
+      "name": "VersionHandler",
+      "doc": "Version.",
+      "path": "/api/1.0/version/",
+      "uri": "http://localhost/api/1.0/version/",
+      "params": [],
+      "actions": [{"name": "read", "method": "GET", "op": null, "restful": true,
+        "doc": "Read the version.\n\nReturns 200 with the version (e.g. 1.9)."}]
+    }
+  }]
+}`
+
+func TestAPICacheLoad(t *testing.T) {
+	dir := t.TempDir()
+	apiDesc, rawJSON, err := ParseAPIDescription([]byte(cacheTestDescription))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewAPICache(dir)
+	c.store(dir, apiDesc.Hash, apiDesc, rawJSON)
+
+	// The parsed result is used when cached with the current version.
+	path := parsedCacheFile(dir, "abc123")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), `"Read the version."`, `"Cached doc."`, 1))
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _, err := c.load(dir, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	action := loaded.Resources[0].Anon.Actions[0]
+	if action.Doc != "Cached doc." || action.DocReturns[200][0] != "with the version (e.g. 1.9)." {
+		t.Fatalf("unexpected cached action: %+v", action)
+	}
+
+	// Results cached by other versions are ignored, and the raw JSON is
+	// parsed again.
+	if err := os.Rename(path, filepath.Join(dir, "abc123.parsed.json")); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _, err = c.load(dir, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action := loaded.Resources[0].Anon.Actions[0]; action.Doc != "Read the version." {
+		t.Fatalf("unexpected parsed action: %+v", action)
+	}
+}
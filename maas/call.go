@@ -0,0 +1,277 @@
+package maas
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/gomaasapi"
+)
+
+// ActionCall is a call to an action of the MAAS API, as found in the
+// APIDescription.
+type ActionCall struct {
+	Handler *APIHandler
+	Action  APIAction
+	// Path is the path of the handler, relative to the API version
+	// prefix, with its URI params filled in (e.g. "nodegroups/xyz/interfaces/").
+	Path string
+	// Params holds the converted action params.
+	Params url.Values
+}
+
+// NewActionCall returns the call to the action named op (or with that op)
+// of the given resource. The resource is either a handler name, with or
+// without the "Handler" suffix (e.g. "IPAddresses"), or a handler path
+// relative to the API version prefix (e.g. "nodegroups/xyz/interfaces/").
+// Each arg is "key=value": keys matching the handler params fill in its
+// path, the rest must match the action's documented params (when it has
+// any), and values are converted according to their GoType. Keys can be
+// repeated to pass multiple values.
+func (a *APIDescription) NewActionCall(resource, op string, args []string) (ActionCall, error) {
+	handler, uriParams, err := a.findHandler(resource)
+	if err != nil {
+		return ActionCall{}, err
+	}
+	call := ActionCall{Handler: handler, Params: make(url.Values)}
+	found := false
+	var ops []string
+	for _, action := range handler.Actions {
+		ops = append(ops, action.Name)
+		if action.Name == op || (action.Op != nil && *action.Op == op) {
+			call.Action, found = action, true
+			break
+		}
+	}
+	if !found {
+		return ActionCall{}, fmt.Errorf("%s has no action %q (expected one of: %s)", handler.Name, op, strings.Join(ops, ", "))
+	}
+
+	isURIParam := make(map[string]bool)
+	for _, name := range handler.Params {
+		isURIParam[name] = true
+	}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return ActionCall{}, fmt.Errorf("invalid argument %q: expected key=value", arg)
+		}
+		key, value := parts[0], parts[1]
+		if isURIParam[key] {
+			uriParams[key] = value
+			continue
+		}
+		param, ok := call.Action.DocParams[key]
+		if !ok && len(call.Action.DocParams) > 0 {
+			return ActionCall{}, fmt.Errorf("unknown param %q of %s %s (expected one of: %s)",
+				key, handler.Name, call.Action.Name, strings.Join(call.Action.paramNames(), ", "),
+			)
+		}
+		values, err := convertParam(param, value)
+		if err != nil {
+			return ActionCall{}, fmt.Errorf("invalid param %q: %v", key, err)
+		}
+		call.Params[key] = append(call.Params[key], values...)
+	}
+
+	call.Path = relativePath(handler.Path)
+	for _, name := range handler.Params {
+		value, ok := uriParams[name]
+		if !ok {
+			return ActionCall{}, fmt.Errorf("missing %s=<value> for the path of %s (%s)", name, handler.Name, call.Path)
+		}
+		call.Path = strings.Replace(call.Path, "{"+name+"}", url.PathEscape(value), -1)
+	}
+	return call, nil
+}
+
+// findHandler returns the handler matching resource, as described in
+// NewActionCall, and the URI params taken from resource. Authenticated
+// handlers are preferred.
+func (a *APIDescription) findHandler(resource string) (*APIHandler, map[string]string, error) {
+	name := strings.ToLower(strings.TrimSuffix(resource, "Handler"))
+	path := strings.Trim(resource, "/")
+	var names []string
+	for _, res := range a.Resources {
+		for _, handler := range []*APIHandler{res.Auth, res.Anon} {
+			if handler == nil {
+				continue
+			}
+			names = append(names, handler.Name)
+			if strings.ToLower(strings.TrimSuffix(handler.Name, "Handler")) == name {
+				return handler, make(map[string]string), nil
+			}
+			if uriParams, ok := matchPath(strings.Trim(relativePath(handler.Path), "/"), path); ok {
+				return handler, uriParams, nil
+			}
+		}
+	}
+	sort.Strings(names)
+	return nil, nil, fmt.Errorf("unknown resource %q (expected a path or one of: %s)", resource, strings.Join(names, ", "))
+}
+
+// relativePath returns the given handler path relative to the API version
+// prefix.
+func relativePath(path string) string {
+	prefix := "api/" + APIVersion + "/"
+	if i := strings.Index(path, prefix); i != -1 {
+		return path[i+len(prefix):]
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+// matchPath returns whether path matches the given handler path template
+// (e.g. "nodegroups/{uuid}/interfaces"), and the values of its params.
+func matchPath(template, path string) (map[string]string, bool) {
+	templateParts, pathParts := strings.Split(template, "/"), strings.Split(path, "/")
+	if len(templateParts) != len(pathParts) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range templateParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			// Also accept the template itself.
+			if pathParts[i] != part {
+				params[part[1:len(part)-1]] = pathParts[i]
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// paramNames returns the sorted names of the documented params of a.
+func (a APIAction) paramNames() []string {
+	var names []string
+	for name := range a.DocParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedCodes returns the return codes of a, in order.
+func (a APIAction) sortedCodes() []int {
+	var codes []int
+	for code := range a.DocReturns {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// convertParam checks value is valid for the GoType of param and returns
+// it in the form the API expects. Lists are comma-separated.
+func convertParam(param ActionParam, value string) ([]string, error) {
+	if param.GoType == nil {
+		return []string{value}, nil
+	}
+	switch param.GoType {
+	case reflect.TypeOf(net.IP{}):
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("expected an IP address, got %q", value)
+		}
+		return []string{ip.String()}, nil
+	case reflect.SliceOf(reflect.TypeOf("")):
+		return strings.Split(value, ","), nil
+	}
+	switch param.GoType.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected a boolean, got %q", value)
+		}
+		return []string{strconv.FormatBool(b)}, nil
+	case reflect.Int:
+		i, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %q", value)
+		}
+		return []string{strconv.FormatInt(i, 10)}, nil
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, got %q", value)
+		}
+		return []string{strconv.FormatFloat(f, 'g', -1, 64)}, nil
+	}
+	return []string{value}, nil
+}
+
+// op returns the op of the action, or "" for RESTful actions.
+func (c ActionCall) op() string {
+	if c.Action.Op == nil {
+		return ""
+	}
+	return *c.Action.Op
+}
+
+// Call returns the API call Client.CallAction makes for c.
+func (c *Client) Call(call ActionCall) Call {
+	return newCall(call.Action.Method, c.root.GetSubObject(call.Path), call.op(), call.Params)
+}
+
+// CallAction makes the given call, signed with the client's credentials,
+// and returns the decoded JSON result (nil when there is none).
+func (c *Client) CallAction(call ActionCall) (interface{}, error) {
+	result, err := c.callMethod(call.Action.Method, call.Path, call.op(), call.Params)
+	if err != nil {
+		return nil, errors.Annotatef(err, "%s %s failed", call.Handler.Name, call.Action.Name)
+	}
+	return result, nil
+}
+
+// CallMethod calls the API object at path, relative to the API version
+// prefix, with the given HTTP method, op (empty for RESTful actions) and
+// params, and returns the decoded JSON result (nil when there is none).
+func (c *Client) CallMethod(method, path, op string, params url.Values) (interface{}, error) {
+	result, err := c.callMethod(method, path, op, params)
+	if err != nil {
+		return nil, errors.Annotatef(err, "%s %s failed", method, newCall(method, c.root.GetSubObject(path), op, params).URL)
+	}
+	return result, nil
+}
+
+func (c *Client) callMethod(method, path, op string, params url.Values) (interface{}, error) {
+	obj := c.root.GetSubObject(path)
+	var (
+		result gomaasapi.JSONObject
+		err    error
+	)
+	switch method {
+	case "GET":
+		result, err = obj.CallGet(op, params)
+	case "POST":
+		result, err = obj.CallPost(op, params)
+	case "PUT":
+		var updated gomaasapi.MAASObject
+		if updated, err = obj.Update(params); err == nil {
+			var out interface{}
+			return out, decodeJSON(updated, &out)
+		}
+	case "DELETE":
+		err = obj.Delete()
+	default:
+		return nil, fmt.Errorf("unsupported method %q", method)
+	}
+	if err != nil || method == "DELETE" || result.IsNil() {
+		return nil, err
+	}
+	var out interface{}
+	if err := decodeJSON(result, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
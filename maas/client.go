@@ -0,0 +1,299 @@
+// Package maas provides typed access to the networking parts of the MAAS
+// API (version 1.0): networks, node group interfaces and static IP
+// addresses.
+package maas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/juju/errors"
+	"github.com/juju/gomaasapi"
+)
+
+// APIVersion is the MAAS API version used by Client.
+const APIVersion = "1.0"
+
+// Client provides typed access to the MAAS API.
+type Client struct {
+	root *gomaasapi.MAASObject
+}
+
+// NewClient returns a Client for the MAAS server at serverURL (e.g.
+// "http://192.168.50.2/MAAS"), authenticated with the given OAuth key
+// ("xxx:yyy:zzz").
+func NewClient(serverURL, oauthKey string) (*Client, error) {
+	client, err := gomaasapi.NewAuthenticatedClient(serverURL, oauthKey, APIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect: %v", err)
+	}
+	return NewClientFromRoot(gomaasapi.NewMAAS(*client)), nil
+}
+
+// NewClientFromRoot returns a Client using the given MAAS API root object.
+func NewClientFromRoot(root *gomaasapi.MAASObject) *Client {
+	return &Client{root: root}
+}
+
+// Root returns the MAAS API root object used by the client.
+func (c *Client) Root() *gomaasapi.MAASObject {
+	return c.root
+}
+
+// GetNodeGroupsUUIDs returns the UUIDs of all node groups.
+func (c *Client) GetNodeGroupsUUIDs() ([]string, error) {
+	ng := c.root.GetSubObject("nodegroups")
+	result, err := ng.CallGet("list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get node groups: %v", err)
+	}
+	nodeGroups, err := result.GetArray()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list node groups: %v", err)
+	}
+	uuids := make([]string, len(nodeGroups))
+	for i, ngroup := range nodeGroups {
+		objMap, err := ngroup.GetMap()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get node group #%d object map: %v", i, err)
+		}
+		uuid, ok := objMap["uuid"]
+		if !ok {
+			return nil, fmt.Errorf("cannot get node group #%d UUID from %v", i, objMap)
+		}
+		sUUID, err := uuid.GetString()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get node group #%d UUID as string: %v", i, err)
+		}
+		uuids[i] = sUUID
+	}
+	return uuids, nil
+}
+
+// GetNICs returns all interfaces of the node group with the given UUID.
+func (c *Client) GetNICs(uuidNG string) ([]Interface, error) {
+	ngi := c.root.GetSubObject("nodegroups").GetSubObject(uuidNG).GetSubObject("interfaces")
+	result, err := ngi.CallGet("list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get node group %q interfaces: %v", uuidNG, err)
+	}
+
+	list, err := result.GetArray()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list node group %q interfaces: %v", uuidNG, err)
+	}
+	nics := make([]Interface, len(list))
+	for i, nic := range list {
+		var iface Interface
+		if err := decodeJSON(nic, &iface); err != nil {
+			return nil, err
+		}
+		iface.ClusterID = uuidNG
+		nics[i] = iface
+	}
+	return nics, nil
+}
+
+// GetAllNICs returns the interfaces of all node groups.
+func (c *Client) GetAllNICs() ([]Interface, error) {
+	uuids, err := c.GetNodeGroupsUUIDs()
+	if err != nil {
+		return nil, err
+	}
+	var allNICs []Interface
+	for _, uuid := range uuids {
+		nics, err := c.GetNICs(uuid)
+		if err != nil {
+			return nil, err
+		}
+		allNICs = append(allNICs, nics...)
+	}
+	return allNICs, nil
+}
+
+// GetNetworks returns all networks defined in MAAS, keyed by name.
+func (c *Client) GetNetworks() (map[string]Network, error) {
+	nets := c.root.GetSubObject("networks")
+	result, err := nets.CallGet("", nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get networks: %v", err)
+	}
+
+	list, err := result.GetArray()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list networks: %v", err)
+	}
+	networks := make(map[string]Network, len(list))
+	for i, nw := range list {
+		obj, err := nw.GetMAASObject()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get network #%d: %v", i, err)
+		}
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("serializing to JSON failed: %v", err)
+		}
+		var network Network
+		if err := json.Unmarshal(data, &network); err != nil {
+			return nil, fmt.Errorf("deserializing from JSON failed: %v", err)
+		}
+		networks[network.Name] = network
+	}
+	return networks, nil
+}
+
+// GetIPs returns all statically allocated IP addresses.
+func (c *Client) GetIPs() ([]StaticIP, error) {
+	ipaddrs := c.root.GetSubObject("ipaddresses")
+	result, err := ipaddrs.CallGet("", nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get IPs: %v", err)
+	}
+
+	list, err := result.GetArray()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list IPs: %v", err)
+	}
+	ips := make([]StaticIP, len(list))
+	for i, ip := range list {
+		if err := decodeJSON(ip, &ips[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+// FindNIC returns the first node group interface with a router IP within
+// the given network.
+func (c *Client) FindNIC(nw Network) (Interface, error) {
+	ipNet, err := nw.IPNet()
+	if err != nil {
+		return Interface{}, err
+	}
+	ngUUIDs, err := c.GetNodeGroupsUUIDs()
+	if err != nil {
+		return Interface{}, err
+	}
+	if len(ngUUIDs) == 0 {
+		return Interface{}, fmt.Errorf("no node groups defined")
+	}
+	for _, uuid := range ngUUIDs {
+		nics, err := c.GetNICs(uuid)
+		if err != nil {
+			return Interface{}, err
+		}
+		if nic, ok := matchNIC(ipNet, nics); ok {
+			return nic, nil
+		}
+	}
+	return Interface{}, fmt.Errorf("cannot find any node group interfaces matching network %q", nw.Name)
+}
+
+// MatchNIC returns the first of the given node group interfaces with a
+// router IP within the network, like FindNIC does.
+func MatchNIC(nw Network, nics []Interface) (Interface, bool) {
+	ipNet, err := nw.IPNet()
+	if err != nil {
+		return Interface{}, false
+	}
+	return matchNIC(ipNet, nics)
+}
+
+func matchNIC(ipNet net.IPNet, nics []Interface) (Interface, bool) {
+	for _, nic := range nics {
+		nicIP := net.ParseIP(nic.RouterIP.String())
+		if nicIP != nil && ipNet.Contains(nicIP) {
+			return nic, true
+		}
+	}
+	return Interface{}, false
+}
+
+// Call describes a MAAS API call.
+type Call struct {
+	Method string
+	URL    *url.URL
+	Params url.Values
+}
+
+func (c Call) String() string {
+	return fmt.Sprintf("%s %s %s", c.Method, c.URL, c.Params.Encode())
+}
+
+// newCall returns a Call to the given operation on obj. Like gomaasapi,
+// op is always set for POST calls, even when empty.
+func newCall(method string, obj gomaasapi.MAASObject, op string, params url.Values) Call {
+	callURL := *obj.URL()
+	if op != "" || method == "POST" {
+		callURL.RawQuery = url.Values{"op": {op}}.Encode()
+	}
+	return Call{Method: method, URL: &callURL, Params: params}
+}
+
+// ReserveIPCall returns the call ReserveIP makes with the same arguments.
+func (c *Client) ReserveIPCall(ipNet net.IPNet, ipAddr string) Call {
+	params := make(url.Values)
+	params.Set("network", ipNet.String())
+	if ipAddr != "" {
+		params.Set("requested_address", ipAddr)
+	}
+	return newCall("POST", c.root.GetSubObject("ipaddresses"), "reserve", params)
+}
+
+// ReserveIP reserves a static IP address on the given network. If ipAddr is
+// empty, MAAS picks the address.
+func (c *Client) ReserveIP(ipNet net.IPNet, ipAddr string) (StaticIP, error) {
+	call := c.ReserveIPCall(ipNet, ipAddr)
+	result, err := c.root.GetSubObject("ipaddresses").CallPost("reserve", call.Params)
+	if err != nil {
+		return StaticIP{}, errors.Annotate(err, "MAAS returned")
+	}
+	var staticIP StaticIP
+	if err := decodeJSON(result, &staticIP); err != nil {
+		return StaticIP{}, err
+	}
+	if staticIP.IP.String() != ipAddr && ipAddr != "" {
+		return StaticIP{}, fmt.Errorf("tried to allocate %q, but MAAS returned %q", ipAddr, staticIP.IP)
+	}
+	return staticIP, nil
+}
+
+// ReleaseIPCall returns the call ReleaseIP makes with the same argument.
+func (c *Client) ReleaseIPCall(ipAddr string) Call {
+	params := make(url.Values)
+	params.Set("ip", ipAddr)
+	return newCall("POST", c.root.GetSubObject("ipaddresses"), "release", params)
+}
+
+// ReleaseIP releases the given statically allocated IP address.
+func (c *Client) ReleaseIP(ipAddr string) error {
+	call := c.ReleaseIPCall(ipAddr)
+	if _, err := c.root.GetSubObject("ipaddresses").CallPost("release", call.Params); err != nil {
+		return errors.Annotatef(err, "cannot release %q", ipAddr)
+	}
+	return nil
+}
+
+// StatusCode returns the HTTP status code of the MAAS API error causing
+// err, or 0 if err was not caused by one.
+func StatusCode(err error) int {
+	if serverErr, ok := errors.Cause(err).(gomaasapi.ServerError); ok {
+		return serverErr.StatusCode
+	}
+	return 0
+}
+
+// decodeJSON re-serializes the given MAAS API result (a JSONObject or
+// MAASObject) and decodes it into out.
+func decodeJSON(obj json.Marshaler, out interface{}) error {
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("serializing to JSON failed: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("deserializing from JSON failed: %v", err)
+	}
+	return nil
+}
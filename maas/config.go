@@ -0,0 +1,480 @@
+package maas
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/gomaasapi"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the declarative configuration of MAAS networks and node group
+// interfaces, as exported by ExportConfig and compared by PlanConfig.
+type Config struct {
+	Networks   []NetworkConfig   `yaml:"networks"`
+	Interfaces []InterfaceConfig `yaml:"interfaces"`
+}
+
+// NetworkConfig is the configuration of a network, identified by name.
+type NetworkConfig struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	IP          string   `yaml:"ip"`
+	Netmask     string   `yaml:"netmask"`
+	VLANTag     int      `yaml:"vlan_tag,omitempty"`
+	Gateway     string   `yaml:"gateway,omitempty"`
+	DNSServers  []string `yaml:"dns_servers,omitempty"`
+}
+
+// InterfaceConfig is the configuration of a node group interface,
+// identified by its node group UUID and name.
+type InterfaceConfig struct {
+	ClusterID       string `yaml:"cluster_id"`
+	Name            string `yaml:"name"`
+	Interface       string `yaml:"interface"`
+	RouterIP        string `yaml:"router_ip"`
+	Netmask         string `yaml:"netmask,omitempty"`
+	BroadcastIP     string `yaml:"broadcast_ip,omitempty"`
+	Management      string `yaml:"management"`
+	DHCPRangeLow    string `yaml:"dhcp_range_low,omitempty"`
+	DHCPRangeHigh   string `yaml:"dhcp_range_high,omitempty"`
+	StaticRangeLow  string `yaml:"static_range_low,omitempty"`
+	StaticRangeHigh string `yaml:"static_range_high,omitempty"`
+}
+
+// ID returns "<cluster-id>/<name>", identifying the interface.
+func (i InterfaceConfig) ID() string {
+	return i.ClusterID + "/" + i.Name
+}
+
+// configField is a field of a NetworkConfig or InterfaceConfig, with its
+// value as written in the config, and the parameter and value used to set
+// it via the MAAS API.
+type configField struct {
+	name, value       string
+	param, paramValue string
+}
+
+func (n NetworkConfig) fields() []configField {
+	dnsServers := strings.Join(n.DNSServers, " ")
+	var vlanTag string
+	if n.VLANTag != 0 {
+		vlanTag = strconv.Itoa(n.VLANTag)
+	}
+	return []configField{
+		{"name", n.Name, "name", n.Name},
+		{"description", n.Description, "description", n.Description},
+		{"ip", n.IP, "ip", n.IP},
+		{"netmask", n.Netmask, "netmask", n.Netmask},
+		{"vlan_tag", vlanTag, "vlan_tag", vlanTag},
+		{"gateway", n.Gateway, "default_gateway", n.Gateway},
+		{"dns_servers", dnsServers, "dns_servers", dnsServers},
+	}
+}
+
+func (i InterfaceConfig) fields() []configField {
+	management := i.Management
+	if m, err := ParseManagementType(i.Management); err == nil {
+		management = strconv.Itoa(int(m))
+	}
+	return []configField{
+		{"name", i.Name, "name", i.Name},
+		{"interface", i.Interface, "interface", i.Interface},
+		{"router_ip", i.RouterIP, "ip", i.RouterIP},
+		{"netmask", i.Netmask, "subnet_mask", i.Netmask},
+		{"broadcast_ip", i.BroadcastIP, "broadcast_ip", i.BroadcastIP},
+		{"management", i.Management, "management", management},
+		{"dhcp_range_low", i.DHCPRangeLow, "ip_range_low", i.DHCPRangeLow},
+		{"dhcp_range_high", i.DHCPRangeHigh, "ip_range_high", i.DHCPRangeHigh},
+		{"static_range_low", i.StaticRangeLow, "static_ip_range_low", i.StaticRangeLow},
+		{"static_range_high", i.StaticRangeHigh, "static_ip_range_high", i.StaticRangeHigh},
+	}
+}
+
+// newNetworkConfig returns the configuration of nw.
+func newNetworkConfig(nw Network) NetworkConfig {
+	netmask, _ := FormatMask(nw.Netmask)
+	var dnsServers []string
+	for _, srv := range nw.DNSServers {
+		dnsServers = append(dnsServers, srv.String())
+	}
+	return NetworkConfig{
+		Name:        nw.Name,
+		Description: nw.Description,
+		IP:          nw.IP.String(),
+		Netmask:     netmask,
+		VLANTag:     nw.VLANTag,
+		Gateway:     nw.Gateway.String(),
+		DNSServers:  dnsServers,
+	}
+}
+
+// newInterfaceConfig returns the configuration of nic.
+func newInterfaceConfig(nic Interface) InterfaceConfig {
+	netmask, _ := FormatMask(nic.Netmask)
+	return InterfaceConfig{
+		ClusterID:       nic.ClusterID,
+		Name:            nic.Name,
+		Interface:       nic.Interface,
+		RouterIP:        nic.RouterIP.String(),
+		Netmask:         netmask,
+		BroadcastIP:     nic.BroadcastIP.String(),
+		Management:      nic.Management.String(),
+		DHCPRangeLow:    nic.DHCPRangeLowIP.String(),
+		DHCPRangeHigh:   nic.DHCPRangeHighIP.String(),
+		StaticRangeLow:  nic.StaticRangeLowIP.String(),
+		StaticRangeHigh: nic.StaticRangeHighIP.String(),
+	}
+}
+
+// ExportConfig returns the current configuration of all networks (sorted
+// by name) and node group interfaces.
+func (c *Client) ExportConfig() (Config, error) {
+	networks, err := c.GetNetworks()
+	if err != nil {
+		return Config{}, err
+	}
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var cfg Config
+	for _, name := range names {
+		cfg.Networks = append(cfg.Networks, newNetworkConfig(networks[name]))
+	}
+	uuids, err := c.GetNodeGroupsUUIDs()
+	if err != nil {
+		return Config{}, err
+	}
+	for _, uuid := range uuids {
+		nics, err := c.GetNICs(uuid)
+		if err != nil {
+			return Config{}, err
+		}
+		for _, nic := range nics {
+			cfg.Interfaces = append(cfg.Interfaces, newInterfaceConfig(nic))
+		}
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses a YAML configuration, as written by ExportConfig,
+// verifying it is valid and normalizing addresses, netmasks and management
+// types, so it can be compared to the exported one.
+func ParseConfig(data []byte) (Config, error) {
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("cannot parse config: %v", err)
+	}
+	seen := make(map[string]bool)
+	for i := range cfg.Networks {
+		nw := &cfg.Networks[i]
+		if err := nw.normalize(); err != nil {
+			return Config{}, fmt.Errorf("invalid network #%d: %v", i+1, err)
+		}
+		if seen[nw.Name] {
+			return Config{}, fmt.Errorf("duplicate network %q", nw.Name)
+		}
+		seen[nw.Name] = true
+	}
+	seen = make(map[string]bool)
+	for i := range cfg.Interfaces {
+		nic := &cfg.Interfaces[i]
+		if err := nic.normalize(); err != nil {
+			return Config{}, fmt.Errorf("invalid interface #%d: %v", i+1, err)
+		}
+		if seen[nic.ID()] {
+			return Config{}, fmt.Errorf("duplicate interface %q of node group %q", nic.Name, nic.ClusterID)
+		}
+		seen[nic.ID()] = true
+	}
+	return cfg, nil
+}
+
+func (n *NetworkConfig) normalize() error {
+	if n.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	var err error
+	if n.IP, err = normalizeIP("ip", n.IP, false); err != nil {
+		return err
+	}
+	if n.Netmask, err = normalizeMask("netmask", n.Netmask, false); err != nil {
+		return err
+	}
+	if n.Gateway, err = normalizeIP("gateway", n.Gateway, true); err != nil {
+		return err
+	}
+	for i, srv := range n.DNSServers {
+		// DNS servers can be hostnames as well.
+		if ip := net.ParseIP(srv); ip != nil {
+			n.DNSServers[i] = ip.String()
+		}
+	}
+	return nil
+}
+
+func (i *InterfaceConfig) normalize() error {
+	if i.ClusterID == "" || i.Name == "" {
+		return fmt.Errorf("cluster_id and name are required")
+	}
+	if i.Management != "" {
+		m, err := ParseManagementType(i.Management)
+		if err != nil {
+			return err
+		}
+		i.Management = m.String()
+	}
+
+	var err error
+	if i.RouterIP, err = normalizeIP("router_ip", i.RouterIP, false); err != nil {
+		return err
+	}
+	if i.Netmask, err = normalizeMask("netmask", i.Netmask, true); err != nil {
+		return err
+	}
+	addresses := []struct {
+		name  string
+		value *string
+	}{
+		{"broadcast_ip", &i.BroadcastIP},
+		{"dhcp_range_low", &i.DHCPRangeLow},
+		{"dhcp_range_high", &i.DHCPRangeHigh},
+		{"static_range_low", &i.StaticRangeLow},
+		{"static_range_high", &i.StaticRangeHigh},
+	}
+	for _, addr := range addresses {
+		if *addr.value, err = normalizeIP(addr.name, *addr.value, true); err != nil {
+			return err
+		}
+	}
+	if (i.DHCPRangeLow == "") != (i.DHCPRangeHigh == "") {
+		return fmt.Errorf("dhcp_range_low and dhcp_range_high must be set together")
+	}
+	if (i.StaticRangeLow == "") != (i.StaticRangeHigh == "") {
+		return fmt.Errorf("static_range_low and static_range_high must be set together")
+	}
+	return nil
+}
+
+// withCreateDefaults returns i with the fields needed to create it set to
+// their defaults when omitted: the interface to the name, and the
+// management to Unmanaged.
+func (i InterfaceConfig) withCreateDefaults() InterfaceConfig {
+	if i.Interface == "" {
+		i.Interface = i.Name
+	}
+	if i.Management == "" {
+		i.Management = Unmanaged.String()
+	}
+	return i
+}
+
+// normalizeIP returns the canonical form of the IP address in the given
+// config field.
+func normalizeIP(field, value string, optional bool) (string, error) {
+	if value == "" {
+		if optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s is required", field)
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", fmt.Errorf("invalid %s %q", field, value)
+	}
+	return ip.String(), nil
+}
+
+// normalizeMask returns the canonical form of the netmask in the given
+// config field.
+func normalizeMask(field, value string, optional bool) (string, error) {
+	if value == "" {
+		if optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s is required", field)
+	}
+	mask, err := ParseMask(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %v", field, err)
+	}
+	formatted, _ := FormatMask(mask)
+	return formatted, nil
+}
+
+// Kinds of objects changed by a Change.
+const (
+	KindNetwork   = "network"
+	KindInterface = "interface"
+)
+
+// Actions of a Change.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+)
+
+// Change is a change PlanConfig found necessary to make MAAS match the
+// desired configuration.
+type Change struct {
+	Action string `json:"action" yaml:"action"`
+	Kind   string `json:"kind" yaml:"kind"`
+	// ClusterID is the node group UUID of interfaces.
+	ClusterID string `json:"cluster_id,omitempty" yaml:"cluster_id,omitempty"`
+	Name      string `json:"name" yaml:"name"`
+	// Diffs holds the changed fields (all set fields, when creating).
+	Diffs []FieldDiff `json:"diffs" yaml:"diffs"`
+}
+
+// FieldDiff is a changed field of a network or interface config.
+type FieldDiff struct {
+	Field string `json:"field" yaml:"field"`
+	Old   string `json:"old" yaml:"old"`
+	New   string `json:"new" yaml:"new"`
+
+	param, paramValue string
+}
+
+func (c Change) String() string {
+	lines := []string{c.Action + " " + c.subject()}
+	for _, diff := range c.Diffs {
+		if c.Action == ActionCreate {
+			lines = append(lines, fmt.Sprintf("  %s: %q", diff.Field, diff.New))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s: %q -> %q", diff.Field, diff.Old, diff.New))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// subject describes the network or interface changed.
+func (c Change) subject() string {
+	if c.Kind == KindInterface {
+		return fmt.Sprintf("interface %q of node group %q", c.Name, c.ClusterID)
+	}
+	return fmt.Sprintf("network %q", c.Name)
+}
+
+// params returns the MAAS API parameters to make the change.
+func (c Change) params() url.Values {
+	params := make(url.Values)
+	for _, diff := range c.Diffs {
+		params.Set(diff.param, diff.paramValue)
+	}
+	return params
+}
+
+// PlanConfig returns the changes needed to make the current configuration
+// match the desired one: networks and interfaces to create, and those to
+// update, in the order they appear in desired (networks first). Networks
+// and interfaces missing from desired are left alone, and so are the
+// fields omitted from it (empty, or a zero vlan_tag). The result is never
+// nil.
+func PlanConfig(current, desired Config) []Change {
+	changes := []Change{}
+	networks := make(map[string]NetworkConfig)
+	for _, nw := range current.Networks {
+		networks[nw.Name] = nw
+	}
+	for _, nw := range desired.Networks {
+		change := Change{Kind: KindNetwork, Name: nw.Name}
+		if old, ok := networks[nw.Name]; ok {
+			change.Action, change.Diffs = ActionUpdate, diffFields(old.fields(), nw.fields())
+		} else {
+			change.Action, change.Diffs = ActionCreate, diffFields(nil, nw.fields())
+		}
+		if len(change.Diffs) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	nics := make(map[string]InterfaceConfig)
+	for _, nic := range current.Interfaces {
+		nics[nic.ID()] = nic
+	}
+	for _, nic := range desired.Interfaces {
+		change := Change{Kind: KindInterface, ClusterID: nic.ClusterID, Name: nic.Name}
+		if old, ok := nics[nic.ID()]; ok {
+			change.Action, change.Diffs = ActionUpdate, diffFields(old.fields(), nic.fields())
+		} else {
+			change.Action, change.Diffs = ActionCreate, diffFields(nil, nic.withCreateDefaults().fields())
+		}
+		if len(change.Diffs) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// diffFields returns the fields set in new with different values in old.
+// With no old fields, all set new fields are returned.
+func diffFields(old, new []configField) []FieldDiff {
+	var diffs []FieldDiff
+	for i, field := range new {
+		var oldValue string
+		if old != nil {
+			oldValue = old[i].value
+		}
+		if field.value == "" || field.value == oldValue {
+			continue
+		}
+		diffs = append(diffs, FieldDiff{
+			Field:      field.name,
+			Old:        oldValue,
+			New:        field.value,
+			param:      field.param,
+			paramValue: field.paramValue,
+		})
+	}
+	return diffs
+}
+
+// ApplyChangeCall returns the call ApplyChange makes for change.
+func (c *Client) ApplyChangeCall(change Change) Call {
+	obj, method := c.changeObject(change)
+	var op string
+	if change.Kind == KindInterface && change.Action == ActionCreate {
+		op = "new"
+	}
+	return newCall(method, obj, op, change.params())
+}
+
+// ApplyChange makes the given change, as returned by PlanConfig.
+func (c *Client) ApplyChange(change Change) error {
+	obj, _ := c.changeObject(change)
+	params := change.params()
+	var err error
+	switch {
+	case change.Kind == KindInterface && change.Action == ActionCreate:
+		_, err = obj.CallPost("new", params)
+	case change.Action == ActionCreate:
+		_, err = obj.Post(params)
+	default:
+		_, err = obj.Update(params)
+	}
+	if err != nil {
+		return errors.Annotatef(err, "cannot %s %s", change.Action, change.subject())
+	}
+	return nil
+}
+
+// changeObject returns the API object to call, and the HTTP method to use,
+// to make change.
+func (c *Client) changeObject(change Change) (gomaasapi.MAASObject, string) {
+	var obj gomaasapi.MAASObject
+	if change.Kind == KindInterface {
+		obj = c.root.GetSubObject("nodegroups").GetSubObject(change.ClusterID).GetSubObject("interfaces")
+	} else {
+		obj = c.root.GetSubObject("networks")
+	}
+	if change.Action == ActionCreate {
+		return obj, "POST"
+	}
+	return obj.GetSubObject(change.Name), "PUT"
+}
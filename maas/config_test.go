@@ -0,0 +1,112 @@
+package maas
+
+import (
+	"testing"
+)
+
+var configTestCurrent = Config{
+	Networks: []NetworkConfig{{
+		Name:        "maas-eth0",
+		Description: "PXE network",
+		IP:          "10.20.0.0",
+		Netmask:     "255.255.255.0",
+		VLANTag:     42,
+		Gateway:     "10.20.0.1",
+		DNSServers:  []string{"10.20.0.2"},
+	}},
+	Interfaces: []InterfaceConfig{{
+		ClusterID:       "ng-1",
+		Name:            "eth0",
+		Interface:       "eth0",
+		RouterIP:        "10.20.0.2",
+		Netmask:         "255.255.255.0",
+		BroadcastIP:     "10.20.0.255",
+		Management:      "ManageDNSAndDHCP",
+		DHCPRangeLow:    "10.20.0.10",
+		DHCPRangeHigh:   "10.20.0.99",
+		StaticRangeLow:  "10.20.0.100",
+		StaticRangeHigh: "10.20.0.110",
+	}},
+}
+
+func TestPlanConfig(t *testing.T) {
+	for _, test := range []struct {
+		about    string
+		desired  string
+		expected []string
+	}{{
+		about:   "empty config",
+		desired: "{}",
+	}, {
+		about: "omitted optional fields are unchanged",
+		desired: `
+networks:
+- name: maas-eth0
+  ip: 10.20.0.0
+  netmask: 255.255.255.0
+interfaces:
+- cluster_id: ng-1
+  name: eth0
+  router_ip: 10.20.0.2
+`,
+	}, {
+		about: "set fields are changed",
+		desired: `
+networks:
+- name: maas-eth0
+  ip: 10.20.0.0
+  netmask: 255.255.0.0
+interfaces:
+- cluster_id: ng-1
+  name: eth0
+  router_ip: 10.20.0.2
+  management: 0
+  static_range_high: 10.20.0.120
+  static_range_low: 10.20.0.100
+`,
+		expected: []string{
+			`update network "maas-eth0"` + "\n" + `  netmask: "255.255.255.0" -> "255.255.0.0"`,
+			`update interface "eth0" of node group "ng-1"` + "\n" +
+				`  management: "ManageDNSAndDHCP" -> "Unmanaged"` + "\n" +
+				`  static_range_high: "10.20.0.110" -> "10.20.0.120"`,
+		},
+	}, {
+		about: "omitted fields get defaults when creating",
+		desired: `
+interfaces:
+- cluster_id: ng-1
+  name: eth1
+  router_ip: 10.50.0.2
+`,
+		expected: []string{
+			`create interface "eth1" of node group "ng-1"` + "\n" +
+				`  name: "eth1"` + "\n" +
+				`  interface: "eth1"` + "\n" +
+				`  router_ip: "10.50.0.2"` + "\n" +
+				`  management: "Unmanaged"`,
+		},
+	}} {
+		desired, err := ParseConfig([]byte(test.desired))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.about, err)
+			continue
+		}
+		changes := PlanConfig(configTestCurrent, desired)
+		if changes == nil {
+			t.Errorf("%s: expected no changes to be an empty slice", test.about)
+		}
+		var got []string
+		for _, change := range changes {
+			got = append(got, change.String())
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("%s: expected %d changes, got %q", test.about, len(test.expected), got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%s: expected change %q, got %q", test.about, test.expected[i], got[i])
+			}
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package maas
 
 import (
 	"encoding/json"
@@ -109,9 +109,14 @@ type APIAction struct {
 var (
 	rawDocParams            = regexp.MustCompile(`(?::param )(?P<param>[^: ]+)(?:: )(?P<doc>(\n|.)+.?)`)
 	rawDocParamType         = regexp.MustCompile(`(?::type )(?P<param>[^:]+)(?:: )(?P<type>(\n|.)+)$`)
-	rawDocReturns           = regexp.MustCompile(`(?P<first>[Rr])(?:eturns )(?P<code>\d{3})(?: )(?P<doc>(\n|[^\.])+\.)`)
+	rawDocReturns           = regexp.MustCompile(`(?P<first>[Rr])(?:eturns )(?P<code>\d{3})(?: )(?P<doc>(?:\n|[^.]|\.\S)+?\.)(?:\s|$)`)
 	rawDocExtraSpaces       = regexp.MustCompile(` {2,}`)
 	rawDocParamsExtraSpaces = regexp.MustCompile(`( {2,}|\n |\n)`)
+
+	// The periods of abbreviations do not end the doc of return codes, so
+	// they are replaced by one dot leaders while parsing.
+	hideAbbreviations = strings.NewReplacer("e.g.", "e\u2024g\u2024", "i.e.", "i\u2024e\u2024")
+	showAbbreviations = strings.NewReplacer("e\u2024g\u2024", "e.g.", "i\u2024e\u2024", "i.e.")
 )
 
 func (a APIAction) parseRawDoc() (
@@ -121,7 +126,7 @@ func (a APIAction) parseRawDoc() (
 	err error,
 ) {
 	// Separate pure doc lines from params and returns.
-	rawDoc := a.RawDoc
+	rawDoc := hideAbbreviations.Replace(a.RawDoc)
 	rawDocParts := strings.Split(rawDoc, "\n\n")
 	rawDoc = ""
 	var rawParamsAndReturns string
@@ -135,7 +140,7 @@ func (a APIAction) parseRawDoc() (
 
 	// Strip extra whitespace.
 	rawDoc = rawDocExtraSpaces.ReplaceAllString(rawDoc, " ")
-	rawDoc = strings.TrimSpace(rawDoc)
+	rawDoc = showAbbreviations.Replace(strings.TrimSpace(rawDoc))
 	rawParamsAndReturns = rawDocParamsExtraSpaces.ReplaceAllString(rawParamsAndReturns, " ")
 	rawParamsAndReturns = strings.Replace(rawParamsAndReturns, "  ", " ", -1)
 
@@ -151,11 +156,7 @@ func (a APIAction) parseRawDoc() (
 		if err != nil {
 			return "", nil, nil, fmt.Errorf("unexpected HTTP code %q: %v", code, err)
 		}
-		if existing, ok := docReturns[httpCode]; ok {
-			docReturns[httpCode] = append(existing, doc)
-		} else {
-			docReturns[httpCode] = append([]string(nil), doc)
-		}
+		docReturns[httpCode] = append(docReturns[httpCode], showAbbreviations.Replace(doc))
 
 		rawReturn := fmt.Sprintf("%seturns %d %s", firstLetter, httpCode, doc)
 		lastParamsAndReturns = rawParamsAndReturns
@@ -189,7 +190,7 @@ func (a APIAction) parseRawDoc() (
 
 		docParams[param] = ActionParam{
 			Name:       param,
-			Doc:        docWithoutType,
+			Doc:        showAbbreviations.Replace(docWithoutType),
 			PythonType: pythonType,
 			GoType:     deriveGoTypeFromPythonType(pythonType),
 		}
@@ -205,27 +206,43 @@ func (a APIAction) parseRawDoc() (
 // "http://10.10.19.2/MAAS/") and returns the parsed APIDescription and the
 // indented raw JSON, or an error.
 func GetAPIDescription(apiPrefix string) (*APIDescription, string, error) {
+	bodyData, err := fetchAPIDescription(apiPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+	return ParseAPIDescription(bodyData)
+}
+
+// fetchAPIDescription returns the JSON API description served by MAAS at
+// the given URL prefix.
+func fetchAPIDescription(apiPrefix string) ([]byte, error) {
 	urlPrefix, err := url.Parse(apiPrefix)
 	if err != nil {
-		return nil, "", fmt.Errorf("cannot parse URL prefix %q: %v", apiPrefix, err)
+		return nil, fmt.Errorf("cannot parse URL prefix %q: %v", apiPrefix, err)
 	}
 
 	fullURL, err := urlPrefix.Parse("api/1.0/describe/")
 	if err != nil {
-		return nil, "", fmt.Errorf("cannot parse full URL %q: %v", urlPrefix.String()+"describe/", err)
+		return nil, fmt.Errorf("cannot parse full URL %q: %v", urlPrefix.String()+"describe/", err)
 	}
 
 	response, err := http.Get(fullURL.String())
 	if err != nil {
-		return nil, "", fmt.Errorf("cannot get API description at %q: %v", fullURL.String(), err)
+		return nil, fmt.Errorf("cannot get API description at %q: %v", fullURL.String(), err)
 	}
 
 	defer response.Body.Close()
 	bodyData, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return nil, "", fmt.Errorf("cannot read response body: %v", err)
+		return nil, fmt.Errorf("cannot read response body: %v", err)
 	}
+	return bodyData, nil
+}
 
+// ParseAPIDescription parses the given JSON API description, as returned
+// by MAAS (or printed by "maas-utils -d describe"), and returns it along
+// with the indented raw JSON, or an error.
+func ParseAPIDescription(bodyData []byte) (*APIDescription, string, error) {
 	var apiDescription APIDescription
 	if err := json.Unmarshal(bodyData, &apiDescription); err != nil {
 		return nil, "", fmt.Errorf("cannot unmarshal response JSON: %v", err)
@@ -301,7 +318,8 @@ func (a *APIHandler) Format(prefix, suffix string) string {
 			output += fmt.Sprintf("%s    DocParams: N/A\n", prefix)
 		} else {
 			output += fmt.Sprintf("%s    DocParams:\n", prefix)
-			for paramName, param := range action.DocParams {
+			for _, paramName := range action.paramNames() {
+				param := action.DocParams[paramName]
 				output += fmt.Sprintf("%s      %q:\n", prefix, paramName)
 				output += fmt.Sprintf("%s        Doc: %q\n", prefix, param.Doc)
 				output += fmt.Sprintf("%s        PythonType: %v\n", prefix, param.PythonType)
@@ -313,7 +331,8 @@ func (a *APIHandler) Format(prefix, suffix string) string {
 			output += fmt.Sprintf("%s    DocReturns: N/A\n", prefix)
 		} else {
 			output += fmt.Sprintf("%s    DocReturns:\n", prefix)
-			for code, codeDocs := range action.DocReturns {
+			for _, code := range action.sortedCodes() {
+				codeDocs := action.DocReturns[code]
 				if len(codeDocs) == 1 {
 					output += fmt.Sprintf("%s      %d: %s\n", prefix, code, codeDocs[0])
 				} else {
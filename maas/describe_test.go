@@ -0,0 +1,51 @@
+package maas
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRawDocReturns(t *testing.T) {
+	for _, test := range []struct {
+		about    string
+		rawDoc   string
+		doc      string
+		expected map[int][]string
+	}{{
+		about:  "one sentence per code",
+		rawDoc: "Release an IP.\n\nReturns 404 if the IP is not found.\nReturns 403 if the IP is not yours.",
+		expected: map[int][]string{
+			404: {"if the IP is not found."},
+			403: {"if the IP is not yours."},
+		},
+	}, {
+		about:  "abbreviations and addresses",
+		rawDoc: "Create a token.\n\nReturns 200 with a dict (e.g. {key: 'x'}, i.e. the token) for 10.0.0.1.\nReturns 400 if it fails.",
+		expected: map[int][]string{
+			200: {"with a dict (e.g. {key: 'x'}, i.e. the token) for 10.0.0.1."},
+			400: {"if it fails."},
+		},
+	}, {
+		about:  "repeated code",
+		rawDoc: "Start a node.\n\nReturns 404 if the node is not found.\nReturns 404 if the zone is not found.",
+		expected: map[int][]string{
+			404: {"if the node is not found.", "if the zone is not found."},
+		},
+	}, {
+		about:  "no final period",
+		rawDoc: "Create a token.\n\nReturns 200 with a dict (e.g. {key: 'x'})",
+		doc:    "Create a token.\n\nReturns 200 with a dict (e.g. {key: 'x'})",
+	}} {
+		doc, _, returns, err := APIAction{RawDoc: test.rawDoc}.parseRawDoc()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.about, err)
+			continue
+		}
+		if test.doc != "" && doc != test.doc {
+			t.Errorf("%s: expected doc %q, got %q", test.about, test.doc, doc)
+		}
+		if !reflect.DeepEqual(returns, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.about, test.expected, returns)
+		}
+	}
+}
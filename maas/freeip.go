@@ -0,0 +1,194 @@
+package maas
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// FreeIPStrategy defines how PickFreeIP and PickFreeBlock choose among
+// free addresses.
+type FreeIPStrategy string
+
+const (
+	// FirstFree picks the lowest free address.
+	FirstFree FreeIPStrategy = "first-free"
+	// LastFree picks the highest free address.
+	LastFree FreeIPStrategy = "last-free"
+	// RandomFree picks a free address at random.
+	RandomFree FreeIPStrategy = "random-free"
+)
+
+// FreeIPStrategies lists all supported strategies.
+var FreeIPStrategies = []FreeIPStrategy{FirstFree, LastFree, RandomFree}
+
+// IPRange is an inclusive range of IP addresses.
+type IPRange struct {
+	Low  net.IP
+	High net.IP
+}
+
+// Size returns the number of addresses in the range.
+func (r IPRange) Size() *big.Int {
+	size, err := IPRangeSize(r.Low, r.High)
+	if err != nil {
+		return big.NewInt(0)
+	}
+	return size
+}
+
+func (r IPRange) String() string {
+	if r.Low.Equal(r.High) {
+		return r.Low.String()
+	}
+	return r.Low.String() + "-" + r.High.String()
+}
+
+// OffsetIP returns the address offset addresses after ip (or before it,
+// when offset is negative).
+func OffsetIP(ip net.IP, offset *big.Int) (net.IP, error) {
+	dec, err := IPToDecimal(ip)
+	if err != nil {
+		return nil, err
+	}
+	return DecimalToIP(dec.Add(dec, offset), ip.To4() == nil)
+}
+
+// FreeRanges returns the ranges of addresses within low-high (inclusive),
+// which are not one of the allocated addresses, in ascending order, or an
+// empty slice when all are allocated. Only the allocated addresses are
+// iterated, so it works for IPv6 ranges of any size.
+func FreeRanges(low, high net.IP, allocated []net.IP) ([]IPRange, error) {
+	decLow, decHigh, err := IPRangeToDecimal(low, high)
+	if err != nil {
+		return nil, err
+	}
+	ipv6 := low.To4() == nil
+	taken, err := allocatedInRange(decLow, decHigh, ipv6, allocated)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := []IPRange{}
+	addRange := func(from, to *big.Int) error {
+		rangeLow, err := DecimalToIP(from, ipv6)
+		if err != nil {
+			return err
+		}
+		rangeHigh, err := DecimalToIP(to, ipv6)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, IPRange{Low: rangeLow, High: rangeHigh})
+		return nil
+	}
+	one := big.NewInt(1)
+	next := new(big.Int).Set(decLow)
+	for _, t := range taken {
+		if t.Cmp(next) > 0 {
+			if err := addRange(next, new(big.Int).Sub(t, one)); err != nil {
+				return nil, err
+			}
+		}
+		next = new(big.Int).Add(t, one)
+	}
+	if next.Cmp(decHigh) <= 0 {
+		if err := addRange(next, decHigh); err != nil {
+			return nil, err
+		}
+	}
+	return ranges, nil
+}
+
+// PickFreeIP returns an address in the range low-high (inclusive), which is
+// not one of the allocated addresses, chosen using the given strategy. rnd
+// is only used with RandomFree.
+func PickFreeIP(low, high net.IP, allocated []net.IP, strategy FreeIPStrategy, rnd *rand.Rand) (net.IP, error) {
+	return PickFreeBlock(low, high, allocated, 1, strategy, rnd)
+}
+
+// PickFreeBlock returns the first address of a block of count consecutive
+// addresses in the range low-high (inclusive), none of which is one of
+// the allocated addresses. The block is chosen using the given strategy:
+// the lowest or highest such block, or one at random (each possible block
+// being equally likely). rnd is only used with RandomFree.
+func PickFreeBlock(low, high net.IP, allocated []net.IP, count int, strategy FreeIPStrategy, rnd *rand.Rand) (net.IP, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("invalid block size %d", count)
+	}
+	switch strategy {
+	case FirstFree, LastFree, RandomFree:
+	default:
+		return nil, fmt.Errorf("unknown free IP strategy %q", strategy)
+	}
+	free, err := FreeRanges(low, high, allocated)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the free ranges which can hold the block, and how many blocks
+	// can start in each.
+	size := big.NewInt(int64(count))
+	one := big.NewInt(1)
+	var (
+		candidates []IPRange
+		starts     []*big.Int
+	)
+	total := new(big.Int)
+	for _, r := range free {
+		rangeSize := r.Size()
+		if rangeSize.Cmp(size) < 0 {
+			continue
+		}
+		rangeStarts := rangeSize.Sub(rangeSize, size)
+		rangeStarts.Add(rangeStarts, one)
+		candidates = append(candidates, r)
+		starts = append(starts, rangeStarts)
+		total.Add(total, rangeStarts)
+	}
+	if len(candidates) == 0 && count == 1 {
+		return nil, fmt.Errorf("no free addresses in range %s-%s", low, high)
+	} else if len(candidates) == 0 {
+		return nil, fmt.Errorf("no %d consecutive free addresses in range %s-%s", count, low, high)
+	}
+
+	switch strategy {
+	case FirstFree:
+		return candidates[0].Low, nil
+	case LastFree:
+		last := candidates[len(candidates)-1]
+		return OffsetIP(last.High, big.NewInt(int64(1-count)))
+	}
+	index := new(big.Int).Rand(rnd, total)
+	for i, r := range candidates {
+		if index.Cmp(starts[i]) < 0 {
+			return OffsetIP(r.Low, index)
+		}
+		index.Sub(index, starts[i])
+	}
+	return nil, fmt.Errorf("no %d consecutive free addresses in range %s-%s", count, low, high)
+}
+
+// allocatedInRange returns the sorted, unique decimals of the allocated
+// addresses of the given family within decLow-decHigh.
+func allocatedInRange(decLow, decHigh *big.Int, ipv6 bool, allocated []net.IP) ([]*big.Int, error) {
+	var taken []*big.Int
+	seen := make(map[string]bool)
+	for _, ip := range allocated {
+		if (ip.To4() == nil) != ipv6 || seen[ip.String()] {
+			continue
+		}
+		dec, err := IPToDecimal(ip)
+		if err != nil {
+			return nil, err
+		}
+		if dec.Cmp(decLow) >= 0 && dec.Cmp(decHigh) <= 0 {
+			taken = append(taken, dec)
+			seen[ip.String()] = true
+		}
+	}
+	sort.Slice(taken, func(i, j int) bool { return taken[i].Cmp(taken[j]) < 0 })
+	return taken, nil
+}
@@ -0,0 +1,285 @@
+package maas
+
+import (
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+)
+
+func parseIPs(ips ...string) []net.IP {
+	var parsed []net.IP
+	for _, ip := range ips {
+		parsed = append(parsed, net.ParseIP(ip))
+	}
+	return parsed
+}
+
+func formatRanges(ranges []IPRange) string {
+	var s []string
+	for _, r := range ranges {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, " ")
+}
+
+func TestFreeRanges(t *testing.T) {
+	for _, test := range []struct {
+		about     string
+		low, high string
+		allocated []string
+		expected  string
+		err       string
+	}{{
+		about:    "single-address range",
+		low:      "10.0.0.5",
+		high:     "10.0.0.5",
+		expected: "10.0.0.5",
+	}, {
+		about:     "single-address range, allocated",
+		low:       "10.0.0.5",
+		high:      "10.0.0.5",
+		allocated: []string{"10.0.0.5"},
+		expected:  "",
+	}, {
+		about:     "unsorted and duplicate allocated IPs",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.7", "10.0.0.3", "10.0.0.7", "10.0.0.4"},
+		expected:  "10.0.0.1-10.0.0.2 10.0.0.5-10.0.0.6 10.0.0.8-10.0.0.10",
+	}, {
+		about:     "allocated IPs at both ends",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.10", "10.0.0.1"},
+		expected:  "10.0.0.2-10.0.0.9",
+	}, {
+		about:     "allocated IPs outside the range or of the other family",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.0", "10.0.0.11", "192.168.0.5", "::a"},
+		expected:  "10.0.0.1-10.0.0.10",
+	}, {
+		about:     "IPv6 range",
+		low:       "2001:db8::1",
+		high:      "2001:db8::ffff:ffff:ffff:ffff",
+		allocated: []string{"2001:db8::5", "10.0.0.5", "2001:db8:1::5"},
+		expected:  "2001:db8::1-2001:db8::4 2001:db8::6-2001:db8::ffff:ffff:ffff:ffff",
+	}, {
+		about: "mixed families",
+		low:   "10.0.0.1",
+		high:  "2001:db8::1",
+		err:   "IP range 10.0.0.1-2001:db8::1 mixes IPv4 and IPv6",
+	}, {
+		about: "reversed range",
+		low:   "10.0.0.10",
+		high:  "10.0.0.1",
+		err:   "invalid IP range 10.0.0.10-10.0.0.1",
+	}} {
+		ranges, err := FreeRanges(net.ParseIP(test.low), net.ParseIP(test.high), parseIPs(test.allocated...))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %v", test.about, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.about, err)
+			continue
+		}
+		if ranges == nil {
+			t.Errorf("%s: expected an empty slice, got nil", test.about)
+		}
+		if got := formatRanges(ranges); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.about, test.expected, got)
+		}
+	}
+}
+
+func TestPickFreeIP(t *testing.T) {
+	for _, test := range []struct {
+		about     string
+		low, high string
+		allocated []string
+		strategy  FreeIPStrategy
+		expected  string
+		err       string
+	}{{
+		about:     "first free",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.2", "10.0.0.1"},
+		strategy:  FirstFree,
+		expected:  "10.0.0.3",
+	}, {
+		about:     "last free",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.10", "10.0.0.10"},
+		strategy:  LastFree,
+		expected:  "10.0.0.9",
+	}, {
+		about:    "single-address range",
+		low:      "10.0.0.5",
+		high:     "10.0.0.5",
+		strategy: RandomFree,
+		expected: "10.0.0.5",
+	}, {
+		about:     "IPv6 last free",
+		low:       "2001:db8::",
+		high:      "2001:db8::ffff:ffff:ffff:ffff",
+		allocated: []string{"2001:db8::ffff:ffff:ffff:ffff"},
+		strategy:  LastFree,
+		expected:  "2001:db8::ffff:ffff:ffff:fffe",
+	}, {
+		about:     "no free addresses",
+		low:       "10.0.0.1",
+		high:      "10.0.0.2",
+		allocated: []string{"10.0.0.2", "10.0.0.1"},
+		strategy:  FirstFree,
+		err:       "no free addresses in range 10.0.0.1-10.0.0.2",
+	}, {
+		about:    "unknown strategy",
+		low:      "10.0.0.1",
+		high:     "10.0.0.2",
+		strategy: "any-free",
+		err:      `unknown free IP strategy "any-free"`,
+	}} {
+		ip, err := PickFreeIP(net.ParseIP(test.low), net.ParseIP(test.high), parseIPs(test.allocated...), test.strategy, rand.New(rand.NewSource(1)))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %v", test.about, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.about, err)
+			continue
+		}
+		if ip.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.about, test.expected, ip)
+		}
+	}
+}
+
+func TestPickFreeIPRandom(t *testing.T) {
+	low, high := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.6")
+	allocated := parseIPs("10.0.0.2", "10.0.0.5", "10.0.0.2")
+	free := map[string]bool{"10.0.0.1": true, "10.0.0.3": true, "10.0.0.4": true, "10.0.0.6": true}
+	picked := make(map[string]bool)
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 200; i++ {
+		ip, err := PickFreeIP(low, high, allocated, RandomFree, rnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !free[ip.String()] {
+			t.Fatalf("picked allocated or out of range address %s", ip)
+		}
+		picked[ip.String()] = true
+	}
+	if len(picked) != len(free) {
+		t.Errorf("expected all free addresses to be picked eventually, got %v", picked)
+	}
+}
+
+func TestPickFreeBlock(t *testing.T) {
+	for _, test := range []struct {
+		about     string
+		low, high string
+		allocated []string
+		count     int
+		strategy  FreeIPStrategy
+		expected  string
+		err       string
+	}{{
+		about:     "first block skips too small ranges",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.3", "10.0.0.7"},
+		count:     3,
+		strategy:  FirstFree,
+		expected:  "10.0.0.4",
+	}, {
+		about:     "last block",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.9", "10.0.0.3"},
+		count:     3,
+		strategy:  LastFree,
+		expected:  "10.0.0.6",
+	}, {
+		about:    "whole range",
+		low:      "10.0.0.1",
+		high:     "10.0.0.4",
+		count:    4,
+		strategy: RandomFree,
+		expected: "10.0.0.1",
+	}, {
+		about:    "IPv6 block",
+		low:      "2001:db8::",
+		high:     "2001:db8::ffff:ffff:ffff:ffff",
+		count:    16,
+		strategy: LastFree,
+		expected: "2001:db8::ffff:ffff:ffff:fff0",
+	}, {
+		about:    "count larger than the range",
+		low:      "10.0.0.1",
+		high:     "10.0.0.4",
+		count:    5,
+		strategy: RandomFree,
+		err:      "no 5 consecutive free addresses in range 10.0.0.1-10.0.0.4",
+	}, {
+		about:     "count larger than any free range",
+		low:       "10.0.0.1",
+		high:      "10.0.0.10",
+		allocated: []string{"10.0.0.4", "10.0.0.8"},
+		count:     4,
+		strategy:  FirstFree,
+		err:       "no 4 consecutive free addresses in range 10.0.0.1-10.0.0.10",
+	}, {
+		about:    "invalid count",
+		low:      "10.0.0.1",
+		high:     "10.0.0.4",
+		count:    0,
+		strategy: FirstFree,
+		err:      "invalid block size 0",
+	}} {
+		ip, err := PickFreeBlock(net.ParseIP(test.low), net.ParseIP(test.high), parseIPs(test.allocated...), test.count, test.strategy, rand.New(rand.NewSource(1)))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %v", test.about, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.about, err)
+			continue
+		}
+		if ip.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.about, test.expected, ip)
+		}
+	}
+}
+
+func TestPickFreeBlockRandom(t *testing.T) {
+	low, high := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.10")
+	allocated := parseIPs("10.0.0.3", "10.0.0.7")
+	// Blocks of 3 can start at 10.0.0.4 or 10.0.0.8 only.
+	starts := map[string]bool{"10.0.0.4": true, "10.0.0.8": true}
+	picked := make(map[string]bool)
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		ip, err := PickFreeBlock(low, high, allocated, 3, RandomFree, rnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !starts[ip.String()] {
+			t.Fatalf("picked block starting at %s", ip)
+		}
+		picked[ip.String()] = true
+	}
+	if len(picked) != len(starts) {
+		t.Errorf("expected all blocks to be picked eventually, got %v", picked)
+	}
+}
@@ -0,0 +1,248 @@
+package maas
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// importPath is the import path of this package, used by generated code.
+const importPath = "github.com/dimitern/go-tools/maas"
+
+// GenerateGo returns the source of a Go package with the given name,
+// providing a typed client for the API: one Client method per action of
+// each handler, taking the handler params (which fill in its path) and,
+// for actions with documented params, a struct with one field per param,
+// typed according to its GoType. Actions without documented params take
+// url.Values instead. Doc comments come from the action Doc and DocReturns.
+func (a *APIDescription) GenerateGo(pkg string) ([]byte, error) {
+	g := &generator{imports: map[string]bool{importPath: true}, methods: make(map[string]string)}
+	for _, resource := range a.Resources {
+		for _, handler := range []*APIHandler{resource.Anon, resource.Auth} {
+			if handler == nil {
+				continue
+			}
+			for _, action := range handler.Actions {
+				if err := g.action(handler, action); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by maas-utils describe --generate-go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "// Package %s provides a typed client for the MAAS API, generated\n", pkg)
+	fmt.Fprintf(&out, "// from its description (hash %s).\n", a.Hash)
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg)
+	var imports []string
+	for path := range g.imports {
+		if path != importPath {
+			imports = append(imports, path)
+		}
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	fmt.Fprintf(&out, "\n\t%q\n)\n\n", importPath)
+	fmt.Fprintf(&out, "// Client calls the MAAS API actions.\ntype Client struct {\n\tclient *maas.Client\n}\n\n")
+	fmt.Fprintf(&out, "// NewClient returns a Client making calls with the given client.\n")
+	fmt.Fprintf(&out, "func NewClient(client *maas.Client) *Client {\n\treturn &Client{client: client}\n}\n")
+
+	var names []string
+	for name := range g.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out.WriteString(g.methods[name])
+	}
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cannot format generated code: %v", err)
+	}
+	return src, nil
+}
+
+// generator holds the state of GenerateGo.
+type generator struct {
+	imports map[string]bool
+	// methods holds the source of each method and its params struct, keyed
+	// by method name.
+	methods map[string]string
+}
+
+// action generates the method calling action of handler.
+func (g *generator) action(handler *APIHandler, action APIAction) error {
+	name := exportedName(strings.TrimSuffix(handler.Name, "Handler")) + exportedName(action.Name)
+	if _, ok := g.methods[name]; ok {
+		return fmt.Errorf("cannot generate %s %s: duplicate method %s", handler.Name, action.Name, name)
+	}
+	path := relativePath(handler.Path)
+	var op string
+	if action.Op != nil {
+		op = *action.Op
+	}
+
+	var out bytes.Buffer
+	call := path
+	if op != "" {
+		call += "?op=" + op
+	}
+	fmt.Fprintf(&out, "\n%s", comment(fmt.Sprintf("%s calls %s of %s (%s %s).", name, action.Name, handler.Name, action.Method, call), ""))
+	if action.Doc != "" {
+		fmt.Fprintf(&out, "//\n%s", comment(action.Doc, ""))
+	}
+	codes := action.sortedCodes()
+	if len(codes) > 0 {
+		fmt.Fprintf(&out, "//\n")
+	}
+	for _, code := range codes {
+		for _, doc := range action.DocReturns[code] {
+			out.WriteString(comment(fmt.Sprintf("Returns %d %s", code, doc), ""))
+		}
+	}
+
+	// Build the path from the handler params.
+	var args []string
+	pathExpr := fmt.Sprintf("%q", path)
+	for _, param := range handler.Params {
+		arg := argName(param)
+		args = append(args, arg+" string")
+		pathExpr = strings.Replace(pathExpr, "{"+param+"}", `" + url.PathEscape(`+arg+`) + "`, -1)
+		g.imports["net/url"] = true
+	}
+	pathExpr = strings.Replace(pathExpr, ` + ""`, "", -1)
+
+	paramsExpr := "params"
+	var paramsStruct string
+	if len(action.DocParams) == 0 {
+		args = append(args, "params url.Values")
+		g.imports["net/url"] = true
+	} else {
+		structName := name + "Params"
+		args = append(args, "params "+structName)
+		paramsExpr = "params.values()"
+		paramsStruct = g.paramsStruct(structName, name, action)
+	}
+	fmt.Fprintf(&out, "func (c *Client) %s(%s) (interface{}, error) {\n", name, strings.Join(args, ", "))
+	fmt.Fprintf(&out, "\treturn c.client.CallMethod(%q, %s, %q, %s)\n}\n", action.Method, pathExpr, op, paramsExpr)
+	out.WriteString(paramsStruct)
+	g.methods[name] = out.String()
+	return nil
+}
+
+// paramsStruct returns the source of the struct holding the documented
+// params of action, and its values method.
+func (g *generator) paramsStruct(structName, methodName string, action APIAction) string {
+	var out, values bytes.Buffer
+	g.imports["net/url"] = true
+	fmt.Fprintf(&out, "\n%s", comment(fmt.Sprintf("%s holds the params of %s. Zero fields are not sent.", structName, methodName), ""))
+	fmt.Fprintf(&out, "type %s struct {\n", structName)
+	fmt.Fprintf(&values, "\nfunc (p %s) values() url.Values {\n\tv := make(url.Values)\n", structName)
+	for i, paramName := range action.paramNames() {
+		param := action.DocParams[paramName]
+		field := exportedName(paramName)
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		if param.Doc != "" {
+			out.WriteString(comment(param.Doc, "\t"))
+		}
+		var fieldType string
+		switch {
+		case param.GoType == reflect.TypeOf(net.IP{}):
+			fieldType = "net.IP"
+			g.imports["net"] = true
+			fmt.Fprintf(&values, "\tif p.%s != nil {\n\t\tv.Set(%q, p.%s.String())\n\t}\n", field, paramName, field)
+		case param.GoType == reflect.SliceOf(reflect.TypeOf("")):
+			fieldType = "[]string"
+			fmt.Fprintf(&values, "\tfor _, value := range p.%s {\n\t\tv.Add(%q, value)\n\t}\n", field, paramName)
+		case param.GoType != nil && param.GoType.Kind() == reflect.Bool:
+			fieldType = "bool"
+			fmt.Fprintf(&values, "\tif p.%s {\n\t\tv.Set(%q, \"true\")\n\t}\n", field, paramName)
+		case param.GoType != nil && param.GoType.Kind() == reflect.Int:
+			fieldType = "int"
+			g.imports["strconv"] = true
+			fmt.Fprintf(&values, "\tif p.%s != 0 {\n\t\tv.Set(%q, strconv.Itoa(p.%s))\n\t}\n", field, paramName, field)
+		case param.GoType != nil && param.GoType.Kind() == reflect.Float64:
+			fieldType = "float64"
+			g.imports["strconv"] = true
+			fmt.Fprintf(&values, "\tif p.%s != 0 {\n\t\tv.Set(%q, strconv.FormatFloat(p.%s, 'g', -1, 64))\n\t}\n", field, paramName, field)
+		default:
+			// Strings, and types without a Go equivalent.
+			fieldType = "string"
+			fmt.Fprintf(&values, "\tif p.%s != \"\" {\n\t\tv.Set(%q, p.%s)\n\t}\n", field, paramName, field)
+		}
+		fmt.Fprintf(&out, "\t%s %s\n", field, fieldType)
+	}
+	out.WriteString("}\n")
+	values.WriteString("\treturn v\n}\n")
+	return out.String() + values.String()
+}
+
+// comment returns text as a Go comment, with each line indented and
+// wrapped at word boundaries.
+func comment(text, indent string) string {
+	const maxWidth = 76
+	var out string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		current := indent + "//"
+		for _, word := range strings.Fields(line) {
+			if len(current)+1+len(word) > maxWidth && current != indent+"//" {
+				out += current + "\n"
+				current = indent + "//"
+			}
+			current += " " + word
+		}
+		out += current + "\n"
+	}
+	return out
+}
+
+// commonInitialisms are written in upper case in exported names, as
+// golint expects.
+var commonInitialisms = map[string]bool{
+	"api": true, "dhcp": true, "dns": true, "id": true, "ip": true,
+	"mac": true, "uri": true, "url": true, "uuid": true, "vlan": true,
+}
+
+// exportedName converts a Python name like "requested_address" (or a
+// handler name like "IPAddresses") to an exported Go name.
+func exportedName(name string) string {
+	var out string
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if commonInitialisms[part] {
+			out += strings.ToUpper(part)
+			continue
+		}
+		out += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return out
+}
+
+// argName converts a Python name to an unexported Go name.
+func argName(name string) string {
+	arg := []rune(exportedName(name))
+	// Lower the leading upper case letters, except the first letter of
+	// the next word (e.g. "IPRange" becomes "ipRange").
+	for i := 0; i < len(arg) && unicode.IsUpper(arg[i]); i++ {
+		if i > 0 && i+1 < len(arg) && unicode.IsLower(arg[i+1]) {
+			break
+		}
+		arg[i] = unicode.ToLower(arg[i])
+	}
+	if token.IsKeyword(string(arg)) {
+		return string(arg) + "_"
+	}
+	return string(arg)
+}
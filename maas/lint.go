@@ -0,0 +1,182 @@
+package maas
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Checks performed by Lint, used as Issue.Check.
+const (
+	CheckInvalidNetwork       = "invalid-network"
+	CheckInvalidInterface     = "invalid-interface"
+	CheckStaticDHCPOverlap    = "static-dhcp-overlap"
+	CheckRangeOutsideSubnet   = "range-outside-subnet"
+	CheckGatewayOutsideSubnet = "gateway-outside-subnet"
+	CheckNoInterface          = "no-interface"
+	CheckUnmanagedInterface   = "unmanaged-interface"
+	CheckNoStaticRange        = "no-static-range"
+	CheckDuplicateVLANTag     = "duplicate-vlan-tag"
+)
+
+// Issue is a consistency problem found by Lint.
+type Issue struct {
+	Check     string `json:"check" yaml:"check"`
+	Network   string `json:"network,omitempty" yaml:"network,omitempty"`
+	ClusterID string `json:"cluster_id,omitempty" yaml:"cluster_id,omitempty"`
+	Interface string `json:"interface,omitempty" yaml:"interface,omitempty"`
+	Message   string `json:"message" yaml:"message"`
+}
+
+func (i Issue) String() string {
+	var subject string
+	switch {
+	case i.Interface != "":
+		subject = fmt.Sprintf("interface %q of node group %q", i.Interface, i.ClusterID)
+	case i.Network != "":
+		subject = fmt.Sprintf("network %q", i.Network)
+	default:
+		subject = "networks"
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Check, subject, i.Message)
+}
+
+// Lint checks the given networks and node group interfaces for problems
+// which would make reserving IPs on them fail or misbehave:
+//   - interface static ranges overlapping DHCP ranges;
+//   - interface ranges outside the interface subnet;
+//   - network gateways outside the network subnet;
+//   - networks without a matching interface (see MatchNIC);
+//   - matched interfaces which are unmanaged, or without a static range;
+//   - VLAN tags used by more than one network.
+//
+// Interface issues come first, in the order of nics, followed by network
+// issues, sorted by network name. The result is not nil, even without
+// issues, so it marshals as an empty list.
+func Lint(networks map[string]Network, nics []Interface) []Issue {
+	issues := []Issue{}
+	for _, nic := range nics {
+		issues = append(issues, lintInterface(nic)...)
+	}
+
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vlans := make(map[int][]string)
+	var tags []int
+	for _, name := range names {
+		nw := networks[name]
+		issues = append(issues, lintNetwork(nw, nics)...)
+		if nw.VLANTag == 0 {
+			continue
+		}
+		if _, ok := vlans[nw.VLANTag]; !ok {
+			tags = append(tags, nw.VLANTag)
+		}
+		vlans[nw.VLANTag] = append(vlans[nw.VLANTag], fmt.Sprintf("%q", name))
+	}
+	sort.Ints(tags)
+	for _, tag := range tags {
+		if len(vlans[tag]) > 1 {
+			issues = append(issues, Issue{
+				Check:   CheckDuplicateVLANTag,
+				Message: fmt.Sprintf("VLAN tag %d used by networks %s", tag, strings.Join(vlans[tag], ", ")),
+			})
+		}
+	}
+	return issues
+}
+
+// lintNetwork checks the gateway of nw, and the interface matching it.
+func lintNetwork(nw Network, nics []Interface) []Issue {
+	newIssue := func(check, f string, a ...interface{}) Issue {
+		return Issue{Check: check, Network: nw.Name, Message: fmt.Sprintf(f, a...)}
+	}
+	ipNet, err := nw.IPNet()
+	if err != nil {
+		return []Issue{newIssue(CheckInvalidNetwork, "%v", err)}
+	}
+	var issues []Issue
+	if !nw.Gateway.IsEmpty() && !ipNet.Contains(nw.Gateway.IP) {
+		issues = append(issues, newIssue(CheckGatewayOutsideSubnet, "gateway %s is outside %s", nw.Gateway, ipNet.String()))
+	}
+	nic, ok := matchNIC(ipNet, nics)
+	if !ok {
+		return append(issues, newIssue(CheckNoInterface, "no node group interface has a router IP within %s", ipNet.String()))
+	}
+	newNICIssue := func(check, f string, a ...interface{}) Issue {
+		issue := newIssue(check, f, a...)
+		issue.ClusterID, issue.Interface = nic.ClusterID, nic.Name
+		return issue
+	}
+	if nic.Management == Unmanaged {
+		issues = append(issues, newNICIssue(CheckUnmanagedInterface, "matches network %q, but is unmanaged", nw.Name))
+	}
+	if !nic.HasStaticRange() {
+		issues = append(issues, newNICIssue(CheckNoStaticRange, "matches network %q, but has no static range", nw.Name))
+	}
+	return issues
+}
+
+// lintInterface checks the DHCP and static ranges of nic.
+func lintInterface(nic Interface) []Issue {
+	newIssue := func(check, f string, a ...interface{}) Issue {
+		return Issue{Check: check, ClusterID: nic.ClusterID, Interface: nic.Name, Message: fmt.Sprintf(f, a...)}
+	}
+	ipNet, err := nic.IPNet()
+	if err != nil {
+		return []Issue{newIssue(CheckInvalidInterface, "%v", err)}
+	}
+	var issues []Issue
+	ranges := []struct {
+		name      string
+		low, high Address
+	}{
+		{"DHCP", nic.DHCPRangeLowIP, nic.DHCPRangeHighIP},
+		{"static", nic.StaticRangeLowIP, nic.StaticRangeHighIP},
+	}
+	for _, r := range ranges {
+		for _, ip := range []Address{r.low, r.high} {
+			if !ip.IsEmpty() && !ipNet.Contains(ip.IP) {
+				issues = append(issues, newIssue(CheckRangeOutsideSubnet, "%s range %s is outside %s", r.name, formatIPRange(r.low, r.high), ipNet.String()))
+				break
+			}
+		}
+	}
+	if nic.HasStaticRange() && !nic.DHCPRangeLowIP.IsEmpty() && !nic.DHCPRangeHighIP.IsEmpty() {
+		overlap, err := rangesOverlap(nic.StaticRangeLowIP.IP, nic.StaticRangeHighIP.IP, nic.DHCPRangeLowIP.IP, nic.DHCPRangeHighIP.IP)
+		if err != nil {
+			issues = append(issues, newIssue(CheckInvalidInterface, "%v", err))
+		} else if overlap {
+			issues = append(issues, newIssue(CheckStaticDHCPOverlap, "static range %s overlaps DHCP range %s",
+				formatIPRange(nic.StaticRangeLowIP, nic.StaticRangeHighIP),
+				formatIPRange(nic.DHCPRangeLowIP, nic.DHCPRangeHighIP),
+			))
+		}
+	}
+	return issues
+}
+
+// rangesOverlap returns whether the inclusive ranges low1-high1 and
+// low2-high2 have any addresses in common.
+func rangesOverlap(low1, high1, low2, high2 net.IP) (bool, error) {
+	decLow1, decHigh1, err := IPRangeToDecimal(low1, high1)
+	if err != nil {
+		return false, err
+	}
+	decLow2, decHigh2, err := IPRangeToDecimal(low2, high2)
+	if err != nil {
+		return false, err
+	}
+	if (low1.To4() == nil) != (low2.To4() == nil) {
+		return false, nil
+	}
+	return DecimalRangeOverlap(decLow1, decHigh1, decLow2, decHigh2).Sign() > 0, nil
+}
+
+func formatIPRange(low, high Address) string {
+	return low.String() + "-" + high.String()
+}
@@ -0,0 +1,35 @@
+//go:build ignore
+
+// gen saves the API description served by maastest to
+// testdata/describe.json, and generates maasapi.go from it.
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/dimitern/go-tools/maas"
+	"github.com/dimitern/go-tools/maas/maastest"
+)
+
+func main() {
+	srv := maastest.NewServer()
+	defer srv.Close()
+	apiDesc, rawJSON, err := maas.GetAPIDescription(srv.URL + "/")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Keep the fixture the same whatever port the server listens on.
+	rawJSON = strings.Replace(rawJSON, srv.URL, "http://localhost", -1)
+	if err := ioutil.WriteFile("testdata/describe.json", []byte(rawJSON+"\n"), 0644); err != nil {
+		log.Fatal(err)
+	}
+	src, err := apiDesc.GenerateGo("maasapi")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("maasapi.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,6 @@
+package maasapi
+
+// maasapi.go is generated from testdata/describe.json, the API description
+// served by the fake MAAS server in maas/maastest, which only covers the
+// handlers maas-utils uses. Regenerating also saves the description again.
+//go:generate go run gen.go
@@ -0,0 +1,312 @@
+// Code generated by maas-utils describe --generate-go. DO NOT EDIT.
+
+// Package maasapi provides a typed client for the MAAS API, generated
+// from its description (hash 7b70a9663f70afa0463be00060e35868dc452f12).
+package maasapi
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/dimitern/go-tools/maas"
+)
+
+// Client calls the MAAS API actions.
+type Client struct {
+	client *maas.Client
+}
+
+// NewClient returns a Client making calls with the given client.
+func NewClient(client *maas.Client) *Client {
+	return &Client{client: client}
+}
+
+// AnonNodeGroupsList calls list of AnonNodeGroupsHandler (GET
+// nodegroups/?op=list).
+//
+// List of node groups.
+func (c *Client) AnonNodeGroupsList(params url.Values) (interface{}, error) {
+	return c.client.CallMethod("GET", "nodegroups/", "list", params)
+}
+
+// DescribeRead calls read of DescribeHandler (GET describe/).
+//
+// Return a description of the whole MAAS API.
+//
+// Returns 200 with a JSON description of the API.
+func (c *Client) DescribeRead(params url.Values) (interface{}, error) {
+	return c.client.CallMethod("GET", "describe/", "", params)
+}
+
+// IPAddressesRead calls read of IPAddressesHandler (GET ipaddresses/).
+//
+// List IPAddresses.
+//
+// Get a listing of all IPAddresses allocated to the requesting user.
+func (c *Client) IPAddressesRead(params url.Values) (interface{}, error) {
+	return c.client.CallMethod("GET", "ipaddresses/", "", params)
+}
+
+// IPAddressesRelease calls release of IPAddressesHandler (POST
+// ipaddresses/?op=release).
+//
+// Release an IP address that was previously reserved by the user.
+//
+// Returns 404 if the provided IP address is not found.
+func (c *Client) IPAddressesRelease(params IPAddressesReleaseParams) (interface{}, error) {
+	return c.client.CallMethod("POST", "ipaddresses/", "release", params.values())
+}
+
+// IPAddressesReleaseParams holds the params of IPAddressesRelease. Zero
+// fields are not sent.
+type IPAddressesReleaseParams struct {
+	// The IP address to release.
+	IP string
+}
+
+func (p IPAddressesReleaseParams) values() url.Values {
+	v := make(url.Values)
+	if p.IP != "" {
+		v.Set("ip", p.IP)
+	}
+	return v
+}
+
+// IPAddressesReserve calls reserve of IPAddressesHandler (POST
+// ipaddresses/?op=reserve).
+//
+// Reserve an IP address for use outside of MAAS.
+//
+// Returns an IP adddress for which MAAS will not allow any of its known
+// devices and Nodes to use; it is free for use by the requesting user
+// until released by the user.
+//
+// Returns 400 if there is a problem with the supplied parameters.
+// Returns 403 if the requested address is outside the static range.
+// Returns 404 if there is no network matching the supplied CIDR.
+// Returns 409 if the requested address is already allocated.
+// Returns 503 if there are no more IP addresses available.
+func (c *Client) IPAddressesReserve(params IPAddressesReserveParams) (interface{}, error) {
+	return c.client.CallMethod("POST", "ipaddresses/", "reserve", params.values())
+}
+
+// IPAddressesReserveParams holds the params of IPAddressesReserve. Zero
+// fields are not sent.
+type IPAddressesReserveParams struct {
+	// CIDR representation of the network on which the IP reservation is
+	// required. e.g. 10.1.2.0/24
+	Network string
+
+	// the requested address, which must be within a cluster interface's static
+	// IP address range.
+	RequestedAddress string
+}
+
+func (p IPAddressesReserveParams) values() url.Values {
+	v := make(url.Values)
+	if p.Network != "" {
+		v.Set("network", p.Network)
+	}
+	if p.RequestedAddress != "" {
+		v.Set("requested_address", p.RequestedAddress)
+	}
+	return v
+}
+
+// NetworkUpdate calls update of NetworkHandler (PUT networks/{name}/).
+//
+// Update network definition.
+//
+// Takes the same parameters as networks create, all optional.
+//
+// Returns 404 if the network is not found.
+func (c *Client) NetworkUpdate(name string, params url.Values) (interface{}, error) {
+	return c.client.CallMethod("PUT", "networks/"+url.PathEscape(name)+"/", "", params)
+}
+
+// NetworksCreate calls create of NetworksHandler (POST networks/).
+//
+// Define a network.
+func (c *Client) NetworksCreate(params NetworksCreateParams) (interface{}, error) {
+	return c.client.CallMethod("POST", "networks/", "", params.values())
+}
+
+// NetworksCreateParams holds the params of NetworksCreate. Zero fields are
+// not sent.
+type NetworksCreateParams struct {
+	// Optional default gateway for the network.
+	DefaultGateway string
+
+	// Detailed description of the network.
+	Description string
+
+	// Optional space-separated list of DNS servers.
+	DNSServers string
+
+	// Base IP address for the network, e.g. 10.1.0.0.
+	IP string
+
+	// A simple name for the network, to make it easier to refer to.
+	Name string
+
+	// Subnet mask to indicate which parts of an IP address are part of the
+	// network address.
+	Netmask string
+
+	// Optional VLAN tag: a number between 1 and 0xffe.
+	VLANTag int
+}
+
+func (p NetworksCreateParams) values() url.Values {
+	v := make(url.Values)
+	if p.DefaultGateway != "" {
+		v.Set("default_gateway", p.DefaultGateway)
+	}
+	if p.Description != "" {
+		v.Set("description", p.Description)
+	}
+	if p.DNSServers != "" {
+		v.Set("dns_servers", p.DNSServers)
+	}
+	if p.IP != "" {
+		v.Set("ip", p.IP)
+	}
+	if p.Name != "" {
+		v.Set("name", p.Name)
+	}
+	if p.Netmask != "" {
+		v.Set("netmask", p.Netmask)
+	}
+	if p.VLANTag != 0 {
+		v.Set("vlan_tag", strconv.Itoa(p.VLANTag))
+	}
+	return v
+}
+
+// NetworksRead calls read of NetworksHandler (GET networks/).
+//
+// List networks.
+func (c *Client) NetworksRead(params NetworksReadParams) (interface{}, error) {
+	return c.client.CallMethod("GET", "networks/", "", params.values())
+}
+
+// NetworksReadParams holds the params of NetworksRead. Zero fields are not
+// sent.
+type NetworksReadParams struct {
+	// Optionally, nodes which must be attached to any returned networks.
+	Node []string
+}
+
+func (p NetworksReadParams) values() url.Values {
+	v := make(url.Values)
+	for _, value := range p.Node {
+		v.Add("node", value)
+	}
+	return v
+}
+
+// NodeGroupInterfaceUpdate calls update of NodeGroupInterfaceHandler (PUT
+// nodegroups/{uuid}/interfaces/{name}/).
+//
+// Update a specific NodeGroupInterface.
+//
+// Takes the same parameters as the interfaces new operation, all optional.
+//
+// Returns 404 if the node group or interface is not found.
+func (c *Client) NodeGroupInterfaceUpdate(uuid string, name string, params url.Values) (interface{}, error) {
+	return c.client.CallMethod("PUT", "nodegroups/"+url.PathEscape(uuid)+"/interfaces/"+url.PathEscape(name)+"/", "", params)
+}
+
+// NodeGroupInterfacesList calls list of NodeGroupInterfacesHandler (GET
+// nodegroups/{uuid}/interfaces/?op=list).
+//
+// List of NodeGroupInterfaces of a NodeGroup.
+func (c *Client) NodeGroupInterfacesList(uuid string, params url.Values) (interface{}, error) {
+	return c.client.CallMethod("GET", "nodegroups/"+url.PathEscape(uuid)+"/interfaces/", "list", params)
+}
+
+// NodeGroupInterfacesNew calls new of NodeGroupInterfacesHandler (POST
+// nodegroups/{uuid}/interfaces/?op=new).
+//
+// Create a new NodeGroupInterface for this NodeGroup.
+func (c *Client) NodeGroupInterfacesNew(uuid string, params NodeGroupInterfacesNewParams) (interface{}, error) {
+	return c.client.CallMethod("POST", "nodegroups/"+url.PathEscape(uuid)+"/interfaces/", "new", params.values())
+}
+
+// NodeGroupInterfacesNewParams holds the params of NodeGroupInterfacesNew.
+// Zero fields are not sent.
+type NodeGroupInterfacesNewParams struct {
+	// Broadcast address for this subnet.
+	BroadcastIP net.IP
+
+	// Name of the network interface that connects the cluster controller to
+	// this network.
+	Interface string
+
+	// Static IP of the interface.
+	IP net.IP
+
+	// Highest IP address assigned to nodes.
+	IPRangeHigh net.IP
+
+	// Lowest IP address assigned to nodes.
+	IPRangeLow net.IP
+
+	// The service(s) MAAS should manage on this interface.
+	Management string
+
+	// Name for the interface. Must be unique within this cluster.
+	Name string
+
+	// Highest IP address for static IPs.
+	StaticIPRangeHigh net.IP
+
+	// Lowest IP address for static IPs.
+	StaticIPRangeLow net.IP
+
+	// Subnet mask, e.g. 255.0.0.0.
+	SubnetMask net.IP
+}
+
+func (p NodeGroupInterfacesNewParams) values() url.Values {
+	v := make(url.Values)
+	if p.BroadcastIP != nil {
+		v.Set("broadcast_ip", p.BroadcastIP.String())
+	}
+	if p.Interface != "" {
+		v.Set("interface", p.Interface)
+	}
+	if p.IP != nil {
+		v.Set("ip", p.IP.String())
+	}
+	if p.IPRangeHigh != nil {
+		v.Set("ip_range_high", p.IPRangeHigh.String())
+	}
+	if p.IPRangeLow != nil {
+		v.Set("ip_range_low", p.IPRangeLow.String())
+	}
+	if p.Management != "" {
+		v.Set("management", p.Management)
+	}
+	if p.Name != "" {
+		v.Set("name", p.Name)
+	}
+	if p.StaticIPRangeHigh != nil {
+		v.Set("static_ip_range_high", p.StaticIPRangeHigh.String())
+	}
+	if p.StaticIPRangeLow != nil {
+		v.Set("static_ip_range_low", p.StaticIPRangeLow.String())
+	}
+	if p.SubnetMask != nil {
+		v.Set("subnet_mask", p.SubnetMask.String())
+	}
+	return v
+}
+
+// NodeGroupsList calls list of NodeGroupsHandler (GET nodegroups/?op=list).
+//
+// List of node groups.
+func (c *Client) NodeGroupsList(params url.Values) (interface{}, error) {
+	return c.client.CallMethod("GET", "nodegroups/", "list", params)
+}
@@ -0,0 +1,51 @@
+package maasapi_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/dimitern/go-tools/maas"
+	"github.com/dimitern/go-tools/maas/maastest"
+)
+
+const regenerate = "regenerate it with: go generate ./maas/maasapi"
+
+func TestDescriptionUpToDate(t *testing.T) {
+	srv := maastest.NewServer()
+	defer srv.Close()
+	_, rawJSON, err := maas.GetAPIDescription(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawJSON = strings.Replace(rawJSON, srv.URL, "http://localhost", -1)
+	saved, err := ioutil.ReadFile("testdata/describe.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != rawJSON+"\n" {
+		t.Fatal("testdata/describe.json is out of date; " + regenerate)
+	}
+}
+
+func TestGeneratedClientUpToDate(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/describe.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiDesc, _, err := maas.ParseAPIDescription(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := apiDesc.GenerateGo("maasapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := ioutil.ReadFile("maasapi.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != string(src) {
+		t.Fatal("maasapi.go is out of date; " + regenerate)
+	}
+}
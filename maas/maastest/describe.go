@@ -0,0 +1,228 @@
+package maastest
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+)
+
+type apiAction struct {
+	Name    string  `json:"name"`
+	Doc     string  `json:"doc"`
+	Method  string  `json:"method"`
+	Op      *string `json:"op"`
+	Restful bool    `json:"restful"`
+}
+
+type apiHandler struct {
+	Name    string      `json:"name"`
+	Doc     string      `json:"doc"`
+	Path    string      `json:"path"`
+	URI     string      `json:"uri"`
+	Params  []string    `json:"params"`
+	Actions []apiAction `json:"actions"`
+}
+
+type apiResource struct {
+	Name string      `json:"name"`
+	Anon *apiHandler `json:"anon"`
+	Auth *apiHandler `json:"auth"`
+}
+
+type apiDescription struct {
+	Doc       string        `json:"doc"`
+	Hash      string        `json:"hash"`
+	Resources []apiResource `json:"resources"`
+}
+
+func op(name string) *string {
+	return &name
+}
+
+// describe returns the API description of the handlers implemented by
+// Server, in the same format MAAS uses, with URIs for the given base URL.
+// Like in MAAS, the hash does not depend on the base URL.
+func describe(baseURL string) apiDescription {
+	desc := description(baseURL)
+	data, _ := json.Marshal(description("").Resources)
+	desc.Hash = fmt.Sprintf("%x", sha1.Sum(data))
+	return desc
+}
+
+func description(baseURL string) apiDescription {
+	handler := func(name, doc, path string, params []string, actions ...apiAction) *apiHandler {
+		if params == nil {
+			params = []string{}
+		}
+		return &apiHandler{
+			Name:    name,
+			Doc:     doc,
+			Path:    APIPrefix + path,
+			URI:     baseURL + APIPrefix + path,
+			Params:  params,
+			Actions: actions,
+		}
+	}
+
+	nodeGroupsList := apiAction{
+		Name:   "list",
+		Method: "GET",
+		Op:     op("list"),
+		Doc:    "List of node groups.",
+	}
+	return apiDescription{
+		Doc: "MAAS API",
+		Resources: []apiResource{{
+			Name: "IPAddressesHandler",
+			Auth: handler(
+				"IPAddressesHandler",
+				"Manage IP addresses allocated by MAAS.",
+				"ipaddresses/", nil,
+				apiAction{
+					Name:    "read",
+					Method:  "GET",
+					Restful: true,
+					Doc:     "List IPAddresses.\n\nGet a listing of all IPAddresses allocated to the requesting user.",
+				},
+				apiAction{
+					Name:   "release",
+					Method: "POST",
+					Op:     op("release"),
+					Doc: "Release an IP address that was previously reserved by the user.\n\n" +
+						":param ip: The IP address to release.\n:type ip: unicode\n\n" +
+						"Returns 404 if the provided IP address is not found.",
+				},
+				apiAction{
+					Name:   "reserve",
+					Method: "POST",
+					Op:     op("reserve"),
+					Doc: "Reserve an IP address for use outside of MAAS.\n\n" +
+						"Returns an IP adddress for which MAAS will not allow any of its known\n" +
+						"devices and Nodes to use; it is free for use by the requesting user\n" +
+						"until released by the user.\n\n" +
+						":param network: CIDR representation of the network on which the IP\n" +
+						"    reservation is required. e.g. 10.1.2.0/24\n:type network: unicode\n\n" +
+						":param requested_address: the requested address, which must be within\n" +
+						"    a cluster interface's static IP address range.\n:type requested_address: unicode\n\n" +
+						"Returns 400 if there is a problem with the supplied parameters.\n" +
+						"Returns 403 if the requested address is outside the static range.\n" +
+						"Returns 404 if there is no network matching the supplied CIDR.\n" +
+						"Returns 409 if the requested address is already allocated.\n" +
+						"Returns 503 if there are no more IP addresses available.",
+				},
+			),
+		}, {
+			Name: "NetworksHandler",
+			Auth: handler(
+				"NetworksHandler",
+				"Manage the networks.",
+				"networks/", nil,
+				apiAction{
+					Name:    "read",
+					Method:  "GET",
+					Restful: true,
+					Doc:     "List networks.\n\n:param node: Optionally, nodes which must be attached to any returned\n    networks.\n:type node: iterable",
+				},
+				apiAction{
+					Name:    "create",
+					Method:  "POST",
+					Restful: true,
+					Doc: "Define a network.\n\n" +
+						":param name: A simple name for the network, to make it easier to\n    refer to.\n:type name: unicode\n\n" +
+						":param description: Detailed description of the network.\n:type description: unicode\n\n" +
+						":param ip: Base IP address for the network, e.g. 10.1.0.0.\n:type ip: unicode\n\n" +
+						":param netmask: Subnet mask to indicate which parts of an IP address\n    are part of the network address.\n:type netmask: unicode\n\n" +
+						":param vlan_tag: Optional VLAN tag: a number between 1 and 0xffe.\n:type vlan_tag: int\n\n" +
+						":param default_gateway: Optional default gateway for the network.\n:type default_gateway: unicode\n\n" +
+						":param dns_servers: Optional space-separated list of DNS servers.\n:type dns_servers: unicode",
+				},
+			),
+		}, {
+			Name: "NetworkHandler",
+			Auth: handler(
+				"NetworkHandler",
+				"Manage a network.",
+				"networks/{name}/", []string{"name"},
+				apiAction{
+					Name:    "update",
+					Method:  "PUT",
+					Restful: true,
+					Doc: "Update network definition.\n\n" +
+						"Takes the same parameters as networks create, all optional.\n\n" +
+						"Returns 404 if the network is not found.",
+				},
+			),
+		}, {
+			Name: "NodeGroupsHandler",
+			Anon: handler(
+				"AnonNodeGroupsHandler",
+				"Anonymous access to NodeGroups.",
+				"nodegroups/", nil,
+				nodeGroupsList,
+			),
+			Auth: handler(
+				"NodeGroupsHandler",
+				"Manage the collection of all the nodegroups in this MAAS.",
+				"nodegroups/", nil,
+				nodeGroupsList,
+			),
+		}, {
+			Name: "NodeGroupInterfacesHandler",
+			Auth: handler(
+				"NodeGroupInterfacesHandler",
+				"Manage the collection of all the NodeGroupInterfaces in this MAAS.",
+				"nodegroups/{uuid}/interfaces/", []string{"uuid"},
+				apiAction{
+					Name:   "list",
+					Method: "GET",
+					Op:     op("list"),
+					Doc:    "List of NodeGroupInterfaces of a NodeGroup.",
+				},
+				apiAction{
+					Name:   "new",
+					Method: "POST",
+					Op:     op("new"),
+					Doc: "Create a new NodeGroupInterface for this NodeGroup.\n\n" +
+						":param name: Name for the interface.  Must be unique within this\n    cluster.\n:type name: unicode\n\n" +
+						":param ip: Static IP of the interface.\n:type ip: unicode (IP Address)\n\n" +
+						":param interface: Name of the network interface that connects the\n    cluster controller to this network.\n:type interface: unicode\n\n" +
+						":param management: The service(s) MAAS should manage on this interface.\n:type management: Vocabulary NODEGROUPINTERFACE_MANAGEMENT\n\n" +
+						":param subnet_mask: Subnet mask, e.g. 255.0.0.0.\n:type subnet_mask: unicode (IP Address)\n\n" +
+						":param broadcast_ip: Broadcast address for this subnet.\n:type broadcast_ip: unicode (IP Address)\n\n" +
+						":param ip_range_low: Lowest IP address assigned to nodes.\n:type ip_range_low: unicode (IP Address)\n\n" +
+						":param ip_range_high: Highest IP address assigned to nodes.\n:type ip_range_high: unicode (IP Address)\n\n" +
+						":param static_ip_range_low: Lowest IP address for static IPs.\n:type static_ip_range_low: unicode (IP Address)\n\n" +
+						":param static_ip_range_high: Highest IP address for static IPs.\n:type static_ip_range_high: unicode (IP Address)",
+				},
+			),
+		}, {
+			Name: "NodeGroupInterfaceHandler",
+			Auth: handler(
+				"NodeGroupInterfaceHandler",
+				"Manage a NodeGroupInterface.",
+				"nodegroups/{uuid}/interfaces/{name}/", []string{"uuid", "name"},
+				apiAction{
+					Name:    "update",
+					Method:  "PUT",
+					Restful: true,
+					Doc: "Update a specific NodeGroupInterface.\n\n" +
+						"Takes the same parameters as the interfaces new operation, all optional.\n\n" +
+						"Returns 404 if the node group or interface is not found.",
+				},
+			),
+		}, {
+			Name: "DescribeHandler",
+			Anon: handler(
+				"DescribeHandler",
+				"Describe the MAAS API.",
+				"describe/", nil,
+				apiAction{
+					Name:    "read",
+					Method:  "GET",
+					Restful: true,
+					Doc:     "Return a description of the whole MAAS API.\n\nReturns 200 with a JSON description of the API.",
+				},
+			),
+		}},
+	}
+}
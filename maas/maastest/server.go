@@ -0,0 +1,586 @@
+// Package maastest provides an in-process fake MAAS API 1.0 server, which
+// keeps networks, node groups, node group interfaces and static IPs in
+// memory. It is intended for testing code using the maas package and the
+// maas-utils command without a live MAAS.
+package maastest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIPrefix is the path prefix of all API URLs served by Server.
+const APIPrefix = "/api/1.0/"
+
+// timeFormat is how MAAS formats timestamps (UTC, without a zone).
+const timeFormat = "2006-01-02T15:04:05.000000"
+
+// Network describes a MAAS network, as returned by the API.
+type Network struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IP          string `json:"ip"`
+	Netmask     string `json:"netmask"`
+	VLANTag     int    `json:"vlan_tag"`
+	DNSServers  string `json:"dns_servers"`
+	Gateway     string `json:"default_gateway"`
+	ResourceURI string `json:"resource_uri"`
+}
+
+// NodeGroupInterface describes a MAAS node group interface, as returned by
+// the API.
+type NodeGroupInterface struct {
+	Name              string `json:"name"`
+	Interface         string `json:"interface"`
+	IP                string `json:"ip"`
+	BroadcastIP       string `json:"broadcast_ip"`
+	SubnetMask        string `json:"subnet_mask"`
+	IPRangeLow        string `json:"ip_range_low"`
+	IPRangeHigh       string `json:"ip_range_high"`
+	StaticIPRangeLow  string `json:"static_ip_range_low"`
+	StaticIPRangeHigh string `json:"static_ip_range_high"`
+	Management        int    `json:"management"`
+	ResourceURI       string `json:"resource_uri"`
+}
+
+// StaticIP describes a MAAS static IP address, as returned by the API.
+type StaticIP struct {
+	IP          string `json:"ip"`
+	AllocType   int    `json:"alloc_type"`
+	Created     string `json:"created"`
+	ResourceURI string `json:"resource_uri"`
+
+	// Hidden addresses are allocated, but not listed by the API, like
+	// addresses reserved by other users in MAAS.
+	Hidden bool `json:"-"`
+}
+
+// AllocUserReserved is the StaticIP.AllocType of addresses reserved via
+// the ipaddresses reserve operation.
+const AllocUserReserved = 4
+
+type nodeGroup struct {
+	uuid       string
+	interfaces []NodeGroupInterface
+}
+
+// Server is a fake MAAS API 1.0 server.
+type Server struct {
+	*httptest.Server
+
+	// Now returns the current time, used for the Created time of
+	// reserved static IPs. Defaults to time.Now.
+	Now func() time.Time
+
+	mu          sync.Mutex
+	networks    map[string]Network
+	nodeGroups  []*nodeGroup
+	ips         map[string]StaticIP
+	requests    []string
+	description []byte
+}
+
+// NewServer starts and returns a new Server, which must be closed after
+// use.
+func NewServer() *Server {
+	s := &Server{
+		Now:      time.Now,
+		networks: make(map[string]Network),
+		ips:      make(map[string]StaticIP),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddNetwork adds or replaces the given network.
+func (s *Server) AddNetwork(nw Network) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nw.ResourceURI = APIPrefix + "networks/" + nw.Name + "/"
+	s.networks[nw.Name] = nw
+}
+
+// AddNodeGroup adds a node group with the given UUID and interfaces.
+func (s *Server) AddNodeGroup(uuid string, nics ...NodeGroupInterface) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range nics {
+		nics[i].ResourceURI = interfaceURI(uuid, nics[i].Name)
+	}
+	s.nodeGroups = append(s.nodeGroups, &nodeGroup{uuid: uuid, interfaces: nics})
+}
+
+// Networks returns all networks, sorted by name.
+func (s *Server) Networks() []Network {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedNetworks()
+}
+
+// NodeGroupInterfaces returns the interfaces of the node group with the
+// given UUID.
+func (s *Server) NodeGroupInterfaces(uuid string) []NodeGroupInterface {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ng := s.findNodeGroup(uuid); ng != nil {
+		return append([]NodeGroupInterface(nil), ng.interfaces...)
+	}
+	return nil
+}
+
+// AddIP adds the given static IP. If ip.Created is empty, the current time
+// is used.
+func (s *Server) AddIP(ip StaticIP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ip.Created == "" {
+		ip.Created = s.Now().UTC().Format(timeFormat)
+	}
+	ip.ResourceURI = APIPrefix + "ipaddresses/"
+	s.ips[ip.IP] = ip
+}
+
+// RemoveIP removes the given static IP, if it exists.
+func (s *Server) RemoveIP(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ips, ip)
+}
+
+// IPs returns all static IPs, sorted by address.
+func (s *Server) IPs() []StaticIP {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedIPs()
+}
+
+// Requests returns all requests served so far, as "METHOD path?query".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// SetDescription replaces the API description returned by the describe
+// endpoint. By default, a description of the handlers implemented by the
+// server is returned.
+func (s *Server) SetDescription(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.description = data
+}
+
+func (s *Server) sortedIPs() []StaticIP {
+	ips := make([]StaticIP, 0, len(s.ips))
+	for _, ip := range s.ips {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(ips[i].IP), net.ParseIP(ips[j].IP)) < 0
+	})
+	return ips
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request := r.Method + " " + r.URL.Path
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.RawQuery
+	}
+	s.requests = append(s.requests, request)
+
+	if !strings.HasPrefix(r.URL.Path, APIPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIPrefix), "/"), "/")
+	if parts[0] == "describe" {
+		s.serveDescribe(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "OAuth ") {
+		http.Error(w, "Authorization Error: 'Expired timestamp' or missing credentials", http.StatusUnauthorized)
+		return
+	}
+
+	op := r.URL.Query().Get("op")
+	switch {
+	case len(parts) == 1 && parts[0] == "networks" && r.Method == "GET":
+		s.listNetworks(w)
+	case len(parts) == 1 && parts[0] == "networks" && r.Method == "POST" && op == "":
+		s.createNetwork(w, r)
+	case len(parts) == 2 && parts[0] == "networks" && r.Method == "PUT":
+		s.updateNetwork(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "nodegroups" && r.Method == "GET" && op == "list":
+		s.listNodeGroups(w)
+	case len(parts) == 3 && parts[0] == "nodegroups" && parts[2] == "interfaces" && r.Method == "GET" && op == "list":
+		s.listNodeGroupInterfaces(w, parts[1])
+	case len(parts) == 3 && parts[0] == "nodegroups" && parts[2] == "interfaces" && r.Method == "POST" && op == "new":
+		s.createNodeGroupInterface(w, r, parts[1])
+	case len(parts) == 4 && parts[0] == "nodegroups" && parts[2] == "interfaces" && r.Method == "PUT":
+		s.updateNodeGroupInterface(w, r, parts[1], parts[3])
+	case len(parts) == 1 && parts[0] == "ipaddresses" && r.Method == "GET":
+		s.listIPs(w)
+	case len(parts) == 1 && parts[0] == "ipaddresses" && r.Method == "POST" && op == "reserve":
+		s.reserveIP(w, r)
+	case len(parts) == 1 && parts[0] == "ipaddresses" && r.Method == "POST" && op == "release":
+		s.releaseIP(w, r)
+	default:
+		http.Error(w, fmt.Sprintf("Unrecognised signature: %s %s", r.Method, op), http.StatusBadRequest)
+	}
+}
+
+func (s *Server) serveDescribe(w http.ResponseWriter, r *http.Request) {
+	if s.description != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.description)
+		return
+	}
+	writeJSON(w, describe("http://"+r.Host))
+}
+
+func (s *Server) sortedNetworks() []Network {
+	names := make([]string, 0, len(s.networks))
+	for name := range s.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nws := make([]Network, len(names))
+	for i, name := range names {
+		nws[i] = s.networks[name]
+	}
+	return nws
+}
+
+func (s *Server) listNetworks(w http.ResponseWriter) {
+	writeJSON(w, s.sortedNetworks())
+}
+
+// createNetwork implements the networks create (POST) operation.
+func (s *Server) createNetwork(w http.ResponseWriter, r *http.Request) {
+	var nw Network
+	if err := setNetworkFields(&nw, r.PostForm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case nw.Name == "" || nw.IP == "" || nw.Netmask == "":
+		http.Error(w, "name, ip and netmask are required", http.StatusBadRequest)
+		return
+	case s.networks[nw.Name].Name != "":
+		http.Error(w, fmt.Sprintf("Network with this Name already exists: %s", nw.Name), http.StatusBadRequest)
+		return
+	}
+	nw.ResourceURI = APIPrefix + "networks/" + nw.Name + "/"
+	s.networks[nw.Name] = nw
+	writeJSON(w, nw)
+}
+
+// updateNetwork implements the network update (PUT) operation.
+func (s *Server) updateNetwork(w http.ResponseWriter, r *http.Request, name string) {
+	nw, ok := s.networks[name]
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err := setNetworkFields(&nw, r.PostForm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delete(s.networks, name)
+	nw.ResourceURI = APIPrefix + "networks/" + nw.Name + "/"
+	s.networks[nw.Name] = nw
+	writeJSON(w, nw)
+}
+
+// setNetworkFields sets the fields of nw given in form.
+func setNetworkFields(nw *Network, form url.Values) error {
+	fields := map[string]*string{
+		"name":            &nw.Name,
+		"description":     &nw.Description,
+		"ip":              &nw.IP,
+		"netmask":         &nw.Netmask,
+		"dns_servers":     &nw.DNSServers,
+		"default_gateway": &nw.Gateway,
+	}
+	for param, field := range fields {
+		if values, ok := form[param]; ok {
+			*field = values[0]
+		}
+	}
+	if values, ok := form["vlan_tag"]; ok {
+		tag, err := strconv.Atoi(values[0])
+		if err != nil {
+			return fmt.Errorf("Invalid vlan_tag %s", values[0])
+		}
+		nw.VLANTag = tag
+	}
+	return nil
+}
+
+func (s *Server) listIPs(w http.ResponseWriter) {
+	ips := []StaticIP{}
+	for _, ip := range s.sortedIPs() {
+		if !ip.Hidden {
+			ips = append(ips, ip)
+		}
+	}
+	writeJSON(w, ips)
+}
+
+func (s *Server) listNodeGroups(w http.ResponseWriter) {
+	groups := make([]map[string]interface{}, len(s.nodeGroups))
+	for i, ng := range s.nodeGroups {
+		groups[i] = map[string]interface{}{
+			"uuid":         ng.uuid,
+			"name":         "maas-cluster-" + ng.uuid,
+			"cluster_name": "Cluster " + ng.uuid,
+			"status":       1,
+		}
+	}
+	writeJSON(w, groups)
+}
+
+func (s *Server) findNodeGroup(uuid string) *nodeGroup {
+	for _, ng := range s.nodeGroups {
+		if ng.uuid == uuid {
+			return ng
+		}
+	}
+	return nil
+}
+
+func (s *Server) listNodeGroupInterfaces(w http.ResponseWriter, uuid string) {
+	ng := s.findNodeGroup(uuid)
+	if ng == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	nics := ng.interfaces
+	if nics == nil {
+		nics = []NodeGroupInterface{}
+	}
+	writeJSON(w, nics)
+}
+
+// createNodeGroupInterface implements the node group interfaces new
+// operation.
+func (s *Server) createNodeGroupInterface(w http.ResponseWriter, r *http.Request, uuid string) {
+	ng := s.findNodeGroup(uuid)
+	if ng == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	var nic NodeGroupInterface
+	if err := setInterfaceFields(&nic, r.PostForm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if nic.Name == "" || nic.IP == "" {
+		http.Error(w, "name and ip are required", http.StatusBadRequest)
+		return
+	}
+	for _, existing := range ng.interfaces {
+		if existing.Name == nic.Name {
+			http.Error(w, fmt.Sprintf("Interface with this Name already exists: %s", nic.Name), http.StatusBadRequest)
+			return
+		}
+	}
+	nic.ResourceURI = interfaceURI(uuid, nic.Name)
+	ng.interfaces = append(ng.interfaces, nic)
+	writeJSON(w, nic)
+}
+
+// updateNodeGroupInterface implements the node group interface update
+// (PUT) operation.
+func (s *Server) updateNodeGroupInterface(w http.ResponseWriter, r *http.Request, uuid, name string) {
+	ng := s.findNodeGroup(uuid)
+	if ng == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	for i := range ng.interfaces {
+		nic := &ng.interfaces[i]
+		if nic.Name != name {
+			continue
+		}
+		updated := *nic
+		if err := setInterfaceFields(&updated, r.PostForm); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updated.ResourceURI = interfaceURI(uuid, updated.Name)
+		*nic = updated
+		writeJSON(w, updated)
+		return
+	}
+	http.Error(w, "Not Found", http.StatusNotFound)
+}
+
+// setInterfaceFields sets the fields of nic given in form.
+func setInterfaceFields(nic *NodeGroupInterface, form url.Values) error {
+	fields := map[string]*string{
+		"name":                 &nic.Name,
+		"interface":            &nic.Interface,
+		"ip":                   &nic.IP,
+		"broadcast_ip":         &nic.BroadcastIP,
+		"subnet_mask":          &nic.SubnetMask,
+		"ip_range_low":         &nic.IPRangeLow,
+		"ip_range_high":        &nic.IPRangeHigh,
+		"static_ip_range_low":  &nic.StaticIPRangeLow,
+		"static_ip_range_high": &nic.StaticIPRangeHigh,
+	}
+	for param, field := range fields {
+		if values, ok := form[param]; ok {
+			*field = values[0]
+		}
+	}
+	if values, ok := form["management"]; ok {
+		management, err := strconv.Atoi(values[0])
+		if err != nil || management < 0 || management > 2 {
+			return fmt.Errorf("Invalid management %s", values[0])
+		}
+		nic.Management = management
+	}
+	return nil
+}
+
+func interfaceURI(uuid, name string) string {
+	return APIPrefix + "nodegroups/" + uuid + "/interfaces/" + name + "/"
+}
+
+// findInterface returns the first interface, in node group order, with an
+// IP within ipNet, like maas.FindNIC does, or nil.
+func (s *Server) findInterface(ipNet *net.IPNet) *NodeGroupInterface {
+	for _, ng := range s.nodeGroups {
+		for i := range ng.interfaces {
+			nic := &ng.interfaces[i]
+			if ip := net.ParseIP(nic.IP); ip != nil && ipNet.Contains(ip) {
+				return nic
+			}
+		}
+	}
+	return nil
+}
+
+// reserveIP implements the ipaddresses reserve operation like MAAS does:
+// the network must match a node group interface with a static range, and a
+// requested address must be free and within that range.
+func (s *Server) reserveIP(w http.ResponseWriter, r *http.Request) {
+	_, ipNet, err := net.ParseCIDR(r.Form.Get("network"))
+	if err != nil {
+		http.Error(w, "Invalid network parameter "+r.Form.Get("network"), http.StatusBadRequest)
+		return
+	}
+	nic := s.findInterface(ipNet)
+	if nic == nil {
+		http.Error(w, "No network found matching "+ipNet.String(), http.StatusNotFound)
+		return
+	}
+	low, high := net.ParseIP(nic.StaticIPRangeLow), net.ParseIP(nic.StaticIPRangeHigh)
+	if low == nil || high == nil {
+		http.Error(w, "No static IP range defined for "+ipNet.String(), http.StatusNotFound)
+		return
+	}
+
+	var ip net.IP
+	if requested := r.Form.Get("requested_address"); requested != "" {
+		ip = net.ParseIP(requested)
+		switch {
+		case ip == nil:
+			http.Error(w, "Invalid requested_address "+requested, http.StatusBadRequest)
+			return
+		case !inRange(ip, low, high):
+			http.Error(w, fmt.Sprintf("%s is not inside the range %s to %s", ip, low, high), http.StatusForbidden)
+			return
+		}
+		if _, taken := s.ips[ip.String()]; taken {
+			http.Error(w, fmt.Sprintf("The IP address %s is already in use.", ip), http.StatusConflict)
+			return
+		}
+	} else {
+		for candidate := low; inRange(candidate, low, high); candidate = nextIP(candidate) {
+			if _, taken := s.ips[candidate.String()]; !taken {
+				ip = candidate
+				break
+			}
+		}
+		if ip == nil {
+			http.Error(w, "No more IPs available in range", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	staticIP := StaticIP{
+		IP:          ip.String(),
+		AllocType:   AllocUserReserved,
+		Created:     s.Now().UTC().Format(timeFormat),
+		ResourceURI: APIPrefix + "ipaddresses/",
+	}
+	s.ips[staticIP.IP] = staticIP
+	writeJSON(w, staticIP)
+}
+
+// releaseIP implements the ipaddresses release operation. Like MAAS, only
+// user-reserved addresses can be released.
+func (s *Server) releaseIP(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.Form.Get("ip"))
+	if ip == nil {
+		http.Error(w, "Invalid ip parameter "+r.Form.Get("ip"), http.StatusBadRequest)
+		return
+	}
+	existing, ok := s.ips[ip.String()]
+	if !ok || existing.AllocType != AllocUserReserved {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	delete(s.ips, ip.String())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, `""`)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func inRange(ip, low, high net.IP) bool {
+	ip, low, high = ip.To16(), low.To16(), high.To16()
+	return bytes.Compare(ip, low) >= 0 && bytes.Compare(ip, high) <= 0
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, net.IPv6len)
+	copy(next, ip.To16())
+	lo := binary.BigEndian.Uint64(next[8:]) + 1
+	binary.BigEndian.PutUint64(next[8:], lo)
+	if lo == 0 {
+		binary.BigEndian.PutUint64(next[:8], binary.BigEndian.Uint64(next[:8])+1)
+	}
+	if ip.To4() != nil {
+		return next.To4()
+	}
+	return next
+}
@@ -0,0 +1,317 @@
+package maas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// The MarshalJSON and MarshalYAML methods below encode the models using a
+// stable schema meant for machine-readable output. It differs from the
+// MAAS API format: enums are encoded by name (or number, when unknown),
+// netmasks as dotted quads plus prefix length, times in RFC 3339 format
+// with a zone, and sizes of address ranges as decimal strings, as IPv6
+// sizes do not fit in a JSON number. The UnmarshalJSON methods accept
+// both formats, so the output can be read back.
+
+func (a Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a Address) MarshalYAML() (interface{}, error) {
+	return a.String(), nil
+}
+
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var addr string
+	if err := json.Unmarshal(data, &addr); err != nil {
+		return err
+	}
+	*a = Address{IP: net.ParseIP(addr), Hostname: addr}
+	return nil
+}
+
+// value returns the name of m, or its number when unknown.
+func (m ManagementType) value() interface{} {
+	if _, err := ParseManagementType(m.String()); err != nil {
+		return int(m)
+	}
+	return m.String()
+}
+
+func (m ManagementType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.value())
+}
+
+func (m ManagementType) MarshalYAML() (interface{}, error) {
+	return m.value(), nil
+}
+
+func (m *ManagementType) UnmarshalJSON(data []byte) error {
+	s, err := enumString(data)
+	if err != nil {
+		return err
+	}
+	*m, err = ParseManagementType(s)
+	return err
+}
+
+// value returns the name of a, or its number when unknown.
+func (a AllocationType) value() interface{} {
+	if _, err := ParseAllocationType(a.String()); err != nil {
+		return int(a)
+	}
+	return a.String()
+}
+
+func (a AllocationType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.value())
+}
+
+func (a AllocationType) MarshalYAML() (interface{}, error) {
+	return a.value(), nil
+}
+
+func (a *AllocationType) UnmarshalJSON(data []byte) error {
+	s, err := enumString(data)
+	if err != nil {
+		return err
+	}
+	*a, err = ParseAllocationType(s)
+	return err
+}
+
+// enumString returns the JSON-encoded enum value in data, given either by
+// name or number, as a string.
+func enumString(data []byte) (string, error) {
+	var val interface{}
+	if err := json.Unmarshal(data, &val); err != nil {
+		return "", err
+	}
+	switch val := val.(type) {
+	case string:
+		return val, nil
+	case float64:
+		return fmt.Sprint(val), nil
+	}
+	return "", fmt.Errorf("expected enum name or number, got %T", val)
+}
+
+// isMarshalled returns whether fields were encoded with MarshalJSON, rather
+// than by the MAAS API.
+func isMarshalled(fields FieldsMap) bool {
+	_, ok := fields["prefix_length"]
+	return ok
+}
+
+// parseFormattedMask is the inverse of FormatMask.
+func parseFormattedMask(mask string) (net.IPMask, error) {
+	if mask == "" {
+		return nil, nil
+	}
+	return ParseMask(mask)
+}
+
+// FormatMask returns the given netmask in dotted quad format (for IPv4), or
+// in IPv6 address format, and its prefix length. An empty or non-canonical
+// mask has a prefix length of -1.
+func FormatMask(mask net.IPMask) (string, int) {
+	if len(mask) == 0 {
+		return "", -1
+	}
+	ones, bits := mask.Size()
+	if bits == 0 {
+		ones = -1
+	}
+	return net.IP(mask).String(), ones
+}
+
+type networkFields struct {
+	Name         string    `json:"name" yaml:"name"`
+	Description  string    `json:"description" yaml:"description"`
+	IP           Address   `json:"ip" yaml:"ip"`
+	Netmask      string    `json:"netmask" yaml:"netmask"`
+	PrefixLength int       `json:"prefix_length" yaml:"prefix_length"`
+	VLANTag      int       `json:"vlan_tag" yaml:"vlan_tag"`
+	DNSServers   Addresses `json:"dns_servers" yaml:"dns_servers"`
+	Gateway      Address   `json:"gateway" yaml:"gateway"`
+}
+
+func (n Network) fields() networkFields {
+	netmask, prefix := FormatMask(n.Netmask)
+	dnsServers := n.DNSServers
+	if dnsServers == nil {
+		dnsServers = Addresses{}
+	}
+	return networkFields{
+		Name:         n.Name,
+		Description:  n.Description,
+		IP:           n.IP,
+		Netmask:      netmask,
+		PrefixLength: prefix,
+		VLANTag:      n.VLANTag,
+		DNSServers:   dnsServers,
+		Gateway:      n.Gateway,
+	}
+}
+
+func (f networkFields) network() (Network, error) {
+	netmask, err := parseFormattedMask(f.Netmask)
+	if err != nil {
+		return Network{}, err
+	}
+	nw := Network{
+		Name:        f.Name,
+		Description: f.Description,
+		IP:          f.IP,
+		Netmask:     netmask,
+		VLANTag:     f.VLANTag,
+		Gateway:     f.Gateway,
+	}
+	if len(f.DNSServers) > 0 {
+		nw.DNSServers = f.DNSServers
+	}
+	return nw, nil
+}
+
+func (n Network) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.fields())
+}
+
+func (n Network) MarshalYAML() (interface{}, error) {
+	return n.fields(), nil
+}
+
+type interfaceFields struct {
+	ClusterID         string         `json:"cluster_id" yaml:"cluster_id"`
+	Name              string         `json:"name" yaml:"name"`
+	Interface         string         `json:"interface" yaml:"interface"`
+	RouterIP          Address        `json:"router_ip" yaml:"router_ip"`
+	BroadcastIP       Address        `json:"broadcast_ip" yaml:"broadcast_ip"`
+	Netmask           string         `json:"netmask" yaml:"netmask"`
+	PrefixLength      int            `json:"prefix_length" yaml:"prefix_length"`
+	Management        ManagementType `json:"management" yaml:"management"`
+	DHCPRangeLowIP    Address        `json:"dhcp_range_low" yaml:"dhcp_range_low"`
+	DHCPRangeHighIP   Address        `json:"dhcp_range_high" yaml:"dhcp_range_high"`
+	StaticRangeLowIP  Address        `json:"static_range_low" yaml:"static_range_low"`
+	StaticRangeHighIP Address        `json:"static_range_high" yaml:"static_range_high"`
+}
+
+func (i Interface) fields() interfaceFields {
+	netmask, prefix := FormatMask(i.Netmask)
+	return interfaceFields{
+		ClusterID:         i.ClusterID,
+		Name:              i.Name,
+		Interface:         i.Interface,
+		RouterIP:          i.RouterIP,
+		BroadcastIP:       i.BroadcastIP,
+		Netmask:           netmask,
+		PrefixLength:      prefix,
+		Management:        i.Management,
+		DHCPRangeLowIP:    i.DHCPRangeLowIP,
+		DHCPRangeHighIP:   i.DHCPRangeHighIP,
+		StaticRangeLowIP:  i.StaticRangeLowIP,
+		StaticRangeHighIP: i.StaticRangeHighIP,
+	}
+}
+
+func (f interfaceFields) nic() (Interface, error) {
+	netmask, err := parseFormattedMask(f.Netmask)
+	if err != nil {
+		return Interface{}, err
+	}
+	return Interface{
+		ClusterID:         f.ClusterID,
+		Name:              f.Name,
+		Interface:         f.Interface,
+		RouterIP:          f.RouterIP,
+		BroadcastIP:       f.BroadcastIP,
+		Netmask:           netmask,
+		Management:        f.Management,
+		DHCPRangeLowIP:    f.DHCPRangeLowIP,
+		DHCPRangeHighIP:   f.DHCPRangeHighIP,
+		StaticRangeLowIP:  f.StaticRangeLowIP,
+		StaticRangeHighIP: f.StaticRangeHighIP,
+	}, nil
+}
+
+func (i Interface) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.fields())
+}
+
+func (i Interface) MarshalYAML() (interface{}, error) {
+	return i.fields(), nil
+}
+
+type staticIPFields struct {
+	IP        Address        `json:"ip" yaml:"ip"`
+	AllocType AllocationType `json:"alloc_type" yaml:"alloc_type"`
+	Created   string         `json:"created" yaml:"created"`
+}
+
+func (s StaticIP) fields() staticIPFields {
+	return staticIPFields{
+		IP:        s.IP,
+		AllocType: s.AllocType,
+		Created:   s.Created.UTC().Format(time.RFC3339),
+	}
+}
+
+func (s StaticIP) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.fields())
+}
+
+func (s StaticIP) MarshalYAML() (interface{}, error) {
+	return s.fields(), nil
+}
+
+type ipRangeFields struct {
+	Low  string `json:"low" yaml:"low"`
+	High string `json:"high" yaml:"high"`
+	Size string `json:"size" yaml:"size"`
+}
+
+func (r IPRange) fields() ipRangeFields {
+	return ipRangeFields{Low: r.Low.String(), High: r.High.String(), Size: r.Size().String()}
+}
+
+func (r IPRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.fields())
+}
+
+func (r IPRange) MarshalYAML() (interface{}, error) {
+	return r.fields(), nil
+}
+
+type poolUsageFields struct {
+	Network     string         `json:"network" yaml:"network"`
+	ClusterID   string         `json:"cluster_id,omitempty" yaml:"cluster_id,omitempty"`
+	Interface   string         `json:"interface,omitempty" yaml:"interface,omitempty"`
+	StaticSize  string         `json:"static_size" yaml:"static_size"`
+	Allocated   map[string]int `json:"allocated" yaml:"allocated"`
+	Free        string         `json:"free" yaml:"free"`
+	DHCPSize    string         `json:"dhcp_size" yaml:"dhcp_size"`
+	Utilization float64        `json:"utilization" yaml:"utilization"`
+}
+
+func (u PoolUsage) fields() poolUsageFields {
+	return poolUsageFields{
+		Network:     u.Network,
+		ClusterID:   u.ClusterID,
+		Interface:   u.Interface,
+		StaticSize:  u.StaticSize.String(),
+		Allocated:   u.Allocated,
+		Free:        u.Free.String(),
+		DHCPSize:    u.DHCPSize.String(),
+		Utilization: u.Utilization,
+	}
+}
+
+func (u PoolUsage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.fields())
+}
+
+func (u PoolUsage) MarshalYAML() (interface{}, error) {
+	return u.fields(), nil
+}
@@ -0,0 +1,98 @@
+package maas
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	addr := func(s string) Address { return Address{IP: net.ParseIP(s), Hostname: s} }
+	for _, test := range []struct {
+		about string
+		value interface{}
+	}{{
+		about: "network",
+		value: &Network{
+			Name:        "maas-eth0",
+			Description: "MAAS network",
+			IP:          addr("10.20.0.0"),
+			Netmask:     net.CIDRMask(24, 32),
+			VLANTag:     42,
+			DNSServers:  Addresses{addr("10.20.0.2"), addr("ns.example.com")},
+			Gateway:     addr("10.20.0.1"),
+		},
+	}, {
+		about: "IPv6 network without DNS servers",
+		value: &Network{
+			Name:    "maas-v6",
+			IP:      addr("2001:db8::"),
+			Netmask: net.CIDRMask(64, 128),
+		},
+	}, {
+		about: "interface",
+		value: &Interface{
+			ClusterID:         "ng-1",
+			Name:              "eth0",
+			Interface:         "eth0",
+			RouterIP:          addr("10.20.0.2"),
+			BroadcastIP:       addr("10.20.0.255"),
+			Netmask:           net.CIDRMask(24, 32),
+			DHCPRangeLowIP:    addr("10.20.0.10"),
+			DHCPRangeHighIP:   addr("10.20.0.99"),
+			StaticRangeLowIP:  addr("10.20.0.100"),
+			StaticRangeHighIP: addr("10.20.0.110"),
+			Management:        ManageDNSAndDHCP,
+		},
+	}, {
+		about: "static IP",
+		value: &StaticIP{
+			AllocType: AllocUserReserved,
+			Created:   time.Date(2015, 10, 1, 12, 30, 0, 0, time.UTC),
+			IP:        addr("10.20.0.100"),
+		},
+	}, {
+		about: "static IP with unknown allocation type",
+		value: &StaticIP{
+			AllocType: AllocationType(5),
+			Created:   time.Date(2015, 10, 1, 12, 30, 0, 0, time.UTC),
+			IP:        addr("10.20.0.100"),
+		},
+	}} {
+		data, err := json.Marshal(test.value)
+		if err != nil {
+			t.Fatalf("%s: %v", test.about, err)
+		}
+		got := reflect.New(reflect.TypeOf(test.value).Elem()).Interface()
+		if err := json.Unmarshal(data, got); err != nil {
+			t.Errorf("%s: cannot read back %s: %v", test.about, data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.value) {
+			t.Errorf("%s: read back %s as %#v, expected %#v", test.about, data, got, test.value)
+		}
+	}
+}
+
+func TestUnmarshalAPIFormat(t *testing.T) {
+	var ip StaticIP
+	data := `{"alloc_type": 4, "ip": "10.20.0.100", "created": "2015-10-01T12:30:00.5"}`
+	if err := json.Unmarshal([]byte(data), &ip); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2015, 10, 1, 12, 30, 0, 5e8, time.UTC)
+	if ip.AllocType != AllocUserReserved || ip.IP.String() != "10.20.0.100" || !ip.Created.Equal(created) {
+		t.Fatalf("unexpected static IP: %#v", ip)
+	}
+
+	var nic Interface
+	data = `{"name": "eth0", "interface": "eth0", "ip": "10.20.0.2", "subnet_mask": "255.255.255.0", "management": 2}`
+	if err := json.Unmarshal([]byte(data), &nic); err != nil {
+		t.Fatal(err)
+	}
+	if nic.RouterIP.String() != "10.20.0.2" || nic.Netmask.String() != "ffffff00" || nic.Management != ManageDNSAndDHCP {
+		t.Fatalf("unexpected interface: %#v", nic)
+	}
+}
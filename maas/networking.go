@@ -1,9 +1,10 @@
-package main
+package maas
 
 import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net"
 	"strconv"
 	"strings"
@@ -56,6 +57,18 @@ func (n *Network) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &fields); err != nil {
 		return err
 	}
+	if isMarshalled(fields) {
+		var nwFields networkFields
+		if err := json.Unmarshal(data, &nwFields); err != nil {
+			return err
+		}
+		nw, err := nwFields.network()
+		if err != nil {
+			return err
+		}
+		*n = nw
+		return nil
+	}
 
 	var err error
 	n.Name, err = fields.StringField("name", false)
@@ -111,6 +124,15 @@ func (n *Network) String() string {
 	return fmt.Sprintf("network %q (%s/%s)", n.Name, n.IP, n.Netmask)
 }
 
+// IPNet returns the network's IP and netmask as net.IPNet.
+func (n *Network) IPNet() (net.IPNet, error) {
+	netIP := net.ParseIP(n.IP.String())
+	if netIP == nil {
+		return net.IPNet{}, fmt.Errorf("unexpected address format %v for network %q", n.IP, n.Name)
+	}
+	return net.IPNet{IP: netIP, Mask: n.Netmask}, nil
+}
+
 // ManagementType describes the way MAAS manages an interface.
 type ManagementType int
 
@@ -132,6 +154,21 @@ func (m ManagementType) String() string {
 	return fmt.Sprintf("<unknown: %d>", m)
 }
 
+// ParseManagementType parses a ManagementType from its name (e.g.
+// "ManageDHCPOnly", case-insensitive) or number (e.g. "1").
+func ParseManagementType(s string) (ManagementType, error) {
+	for _, m := range []ManagementType{Unmanaged, ManageDHCPOnly, ManageDNSAndDHCP} {
+		if strings.EqualFold(s, m.String()) {
+			return m, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < int(Unmanaged) || n > int(ManageDNSAndDHCP) {
+		return 0, fmt.Errorf("invalid management type %q (expected Unmanaged, ManageDHCPOnly, ManageDNSAndDHCP, or 0-2)", s)
+	}
+	return ManagementType(n), nil
+}
+
 // Interface describes a MAAS node group interface.
 type Interface struct {
 	ClusterID         string
@@ -152,6 +189,18 @@ func (i *Interface) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &fields); err != nil {
 		return err
 	}
+	if isMarshalled(fields) {
+		var nicFields interfaceFields
+		if err := json.Unmarshal(data, &nicFields); err != nil {
+			return err
+		}
+		nic, err := nicFields.nic()
+		if err != nil {
+			return err
+		}
+		*i = nic
+		return nil
+	}
 
 	var err error
 	i.Name, err = fields.StringField("name", false)
@@ -214,6 +263,22 @@ func (i *Interface) String() string {
 	return fmt.Sprintf("interface %q (%s/%s)", i.Interface, i.RouterIP, i.Netmask)
 }
 
+// IPNet returns the network of the interface, i.e. its router IP masked
+// with its netmask.
+func (i *Interface) IPNet() (net.IPNet, error) {
+	ip := net.ParseIP(i.RouterIP.String())
+	if ip == nil {
+		return net.IPNet{}, fmt.Errorf("unexpected address format %v for interface %q", i.RouterIP, i.Name)
+	}
+	if len(i.Netmask) == 0 {
+		return net.IPNet{}, fmt.Errorf("interface %q has no netmask", i.Name)
+	}
+	if ip4 := ip.To4(); ip4 != nil && len(i.Netmask) == net.IPv4len {
+		ip = ip4
+	}
+	return net.IPNet{IP: ip.Mask(i.Netmask), Mask: i.Netmask}, nil
+}
+
 // AllocationType describes a StaticIP allocation type used by MAAS.
 type AllocationType int
 
@@ -223,6 +288,9 @@ const (
 	AllocUserReserved AllocationType = 4
 )
 
+// AllocationTypes holds all known allocation types.
+var AllocationTypes = []AllocationType{AllocAuto, AllocSticky, AllocUserReserved}
+
 func (a AllocationType) String() string {
 	switch a {
 	case AllocAuto:
@@ -235,6 +303,21 @@ func (a AllocationType) String() string {
 	return fmt.Sprintf("<unknown: %d>", a)
 }
 
+// ParseAllocationType parses an AllocationType from its name (e.g.
+// "UserReserved", case-insensitive) or number (e.g. "4").
+func ParseAllocationType(s string) (AllocationType, error) {
+	for _, a := range AllocationTypes {
+		if strings.EqualFold(s, a.String()) {
+			return a, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid allocation type %q (expected Auto, Sticky, UserReserved, or a number)", s)
+	}
+	return AllocationType(n), nil
+}
+
 // StaticIP describes a static IP address in MAAS.
 type StaticIP struct {
 	AllocType AllocationType
@@ -248,8 +331,19 @@ func (s *StaticIP) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	allocType, err := fields.IntField("alloc_type", false)
-	s.AllocType = AllocationType(allocType)
+	// The same fields are used by MarshalJSON, which encodes alloc_type
+	// by name.
+	var err error
+	if allocType, ok := fields["alloc_type"].(string); ok {
+		s.AllocType, err = ParseAllocationType(allocType)
+	} else {
+		var n int
+		n, err = fields.IntField("alloc_type", false)
+		s.AllocType = AllocationType(n)
+	}
+	if err != nil {
+		return err
+	}
 	s.IP, err = fields.AddressField("ip", false)
 	if err != nil {
 		return err
@@ -289,6 +383,21 @@ func ParseIPv4Mask(mask string) (net.IPMask, error) {
 	return net.IPMask(bytes), nil
 }
 
+// ParseMask parses a given IPv4 netmask in dotted quad format (e.g.
+// "255.255.240.0") or IPv6 netmask in address format (e.g.
+// "ffff:ffff:ffff:ffff::").
+func ParseMask(mask string) (net.IPMask, error) {
+	mask = strings.TrimSpace(mask)
+	if !strings.Contains(mask, ":") {
+		return ParseIPv4Mask(mask)
+	}
+	ip := net.ParseIP(mask)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IPv6 netmask: %v", mask)
+	}
+	return net.IPMask(ip.To16()), nil
+}
+
 // DecimalToIPv4 converts a decimal to the dotted quad IP address format.
 func DecimalToIPv4(addr uint32) net.IP {
 	bytes := make([]byte, 4)
@@ -304,3 +413,98 @@ func IPv4ToDecimal(ipv4Addr net.IP) (uint32, error) {
 	}
 	return binary.BigEndian.Uint32([]byte(ip)), nil
 }
+
+// DecimalToIP converts a decimal to an IPv4 address, or an IPv6 address
+// when ipv6 is true.
+func DecimalToIP(addr *big.Int, ipv6 bool) (net.IP, error) {
+	size := net.IPv4len
+	if ipv6 {
+		size = net.IPv6len
+	}
+	if addr.Sign() < 0 || addr.BitLen() > size*8 {
+		return nil, fmt.Errorf("%v is out of range for a %d-bit address", addr, size*8)
+	}
+	ip := make(net.IP, size)
+	addr.FillBytes(ip)
+	return ip, nil
+}
+
+// IPToDecimal converts an IPv4 or IPv6 address to its decimal equivalent.
+func IPToDecimal(addr net.IP) (*big.Int, error) {
+	ip := addr.To4()
+	if ip == nil {
+		ip = addr.To16()
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not a valid IP address", addr.String())
+	}
+	return new(big.Int).SetBytes(ip), nil
+}
+
+// IPRangeSize returns the number of addresses between low and high,
+// inclusive.
+func IPRangeSize(low, high net.IP) (*big.Int, error) {
+	decLow, decHigh, err := IPRangeToDecimal(low, high)
+	if err != nil {
+		return nil, err
+	}
+	return decimalRangeSize(decLow, decHigh), nil
+}
+
+// DecimalRangeOverlap returns the number of addresses the inclusive ranges
+// low1-high1 and low2-high2, as returned by IPRangeToDecimal, have in
+// common.
+func DecimalRangeOverlap(low1, high1, low2, high2 *big.Int) *big.Int {
+	low, high := low1, high1
+	if low2.Cmp(low) > 0 {
+		low = low2
+	}
+	if high2.Cmp(high) < 0 {
+		high = high2
+	}
+	if low.Cmp(high) > 0 {
+		return new(big.Int)
+	}
+	return decimalRangeSize(low, high)
+}
+
+func decimalRangeSize(low, high *big.Int) *big.Int {
+	size := new(big.Int).Sub(high, low)
+	return size.Add(size, big.NewInt(1))
+}
+
+// IPInRange returns whether ip is between low and high, inclusive.
+func IPInRange(ip, low, high net.IP) (bool, error) {
+	decLow, decHigh, err := IPRangeToDecimal(low, high)
+	if err != nil {
+		return false, err
+	}
+	if (ip.To4() == nil) != (low.To4() == nil) {
+		return false, nil
+	}
+	dec, err := IPToDecimal(ip)
+	if err != nil {
+		return false, err
+	}
+	return decLow.Cmp(dec) <= 0 && dec.Cmp(decHigh) <= 0, nil
+}
+
+// IPRangeToDecimal converts the bounds of an IP range to decimals, verifying
+// they are of the same family and low <= high.
+func IPRangeToDecimal(low, high net.IP) (*big.Int, *big.Int, error) {
+	if (low.To4() == nil) != (high.To4() == nil) {
+		return nil, nil, fmt.Errorf("IP range %s-%s mixes IPv4 and IPv6", low, high)
+	}
+	decLow, err := IPToDecimal(low)
+	if err != nil {
+		return nil, nil, err
+	}
+	decHigh, err := IPToDecimal(high)
+	if err != nil {
+		return nil, nil, err
+	}
+	if decLow.Cmp(decHigh) > 0 {
+		return nil, nil, fmt.Errorf("invalid IP range %s-%s", low, high)
+	}
+	return decLow, decHigh, nil
+}
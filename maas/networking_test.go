@@ -0,0 +1,33 @@
+package maas
+
+import (
+	"math/big"
+	"net"
+	"testing"
+)
+
+func TestDecimalRangeOverlap(t *testing.T) {
+	for _, test := range []struct {
+		low1, high1, low2, high2 string
+		expected                 int64
+	}{
+		{"10.0.0.1", "10.0.0.10", "10.0.0.5", "10.0.0.20", 6},
+		{"10.0.0.5", "10.0.0.20", "10.0.0.1", "10.0.0.10", 6},
+		{"10.0.0.1", "10.0.0.10", "10.0.0.3", "10.0.0.4", 2},
+		{"10.0.0.1", "10.0.0.10", "10.0.0.10", "10.0.0.10", 1},
+		{"10.0.0.1", "10.0.0.10", "10.0.0.11", "10.0.0.20", 0},
+		{"2001:db8::", "2001:db8::ffff", "2001:db8::ff00", "2001:db8:1::", 256},
+	} {
+		low1, high1, err := IPRangeToDecimal(net.ParseIP(test.low1), net.ParseIP(test.high1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		low2, high2, err := IPRangeToDecimal(net.ParseIP(test.low2), net.ParseIP(test.high2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := DecimalRangeOverlap(low1, high1, low2, high2); got.Cmp(big.NewInt(test.expected)) != 0 {
+			t.Errorf("%s-%s and %s-%s: expected %d, got %s", test.low1, test.high1, test.low2, test.high2, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package maas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// openAPISecurityScheme is the name of the security scheme used by
+// authenticated operations.
+const openAPISecurityScheme = "maasOAuth"
+
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Servers    []openAPIServer                        `json:"servers,omitempty"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+	Hash        string `json:"x-maas-hash,omitempty"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+}
+
+type openAPIParameter struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required"`
+	Schema      openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Content map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPISchema struct {
+	Type        string                   `json:"type,omitempty"`
+	Format      string                   `json:"format,omitempty"`
+	Description string                   `json:"description,omitempty"`
+	Enum        []string                 `json:"enum,omitempty"`
+	Items       *openAPISchema           `json:"items,omitempty"`
+	Properties  map[string]openAPISchema `json:"properties,omitempty"`
+}
+
+type openAPIComponents struct {
+	SecuritySchemes map[string]openAPISecuritySchemeObject `json:"securitySchemes"`
+}
+
+type openAPISecuritySchemeObject struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// OpenAPI returns the API description as an indented OpenAPI 3 JSON
+// document. Each handler path becomes a path, relative to the server URL
+// (the API version prefix), with the handler params as path parameters.
+// As OpenAPI allows a single operation per path and method, the actions
+// of a path sharing a method are merged into one operation, with an "op"
+// query parameter listing their ops (required unless one of them has no
+// op). The documented params of the actions become query parameters (for
+// GET and DELETE) or form fields of the request body, and their documented
+// return codes become responses. Operations with actions of anonymous
+// handlers need no authentication.
+func (a *APIDescription) OpenAPI() ([]byte, error) {
+	doc := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "MAAS API",
+			Description: a.Doc,
+			Version:     APIVersion,
+			Hash:        a.Hash,
+		},
+		Paths: make(map[string]map[string]openAPIOperation),
+		Components: openAPIComponents{
+			SecuritySchemes: map[string]openAPISecuritySchemeObject{
+				openAPISecurityScheme: {
+					Type: "apiKey",
+					In:   "header",
+					Name: "Authorization",
+					Description: `OAuth 1.0a with the PLAINTEXT signature method, using the MAAS API key ` +
+						`('consumer-key:token-key:token-secret'), e.g. 'OAuth oauth_version="1.0", ` +
+						`oauth_signature_method="PLAINTEXT", oauth_consumer_key="...", oauth_token="...", ` +
+						`oauth_signature="&...", oauth_nonce="...", oauth_timestamp="..."'.`,
+				},
+			},
+		},
+	}
+
+	// Authenticated handlers come first, so actions of anonymous handlers
+	// also found in authenticated ones only make their operations
+	// optionally authenticated.
+	operations := make(map[string]map[string]*openAPIActions)
+	for _, anon := range []bool{false, true} {
+		for _, resource := range a.Resources {
+			handler := resource.Auth
+			if anon {
+				handler = resource.Anon
+			}
+			if handler == nil {
+				continue
+			}
+			if doc.Servers == nil {
+				serverURL := strings.TrimSuffix(handler.URI, relativePath(handler.Path))
+				doc.Servers = []openAPIServer{{URL: strings.TrimSuffix(serverURL, "/")}}
+			}
+			path := "/" + relativePath(handler.Path)
+			for _, action := range handler.Actions {
+				method := strings.ToLower(action.Method)
+				if operations[path] == nil {
+					operations[path] = make(map[string]*openAPIActions)
+				}
+				if operations[path][method] == nil {
+					operations[path][method] = &openAPIActions{handler: handler}
+				}
+				operations[path][method].add(action, anon)
+			}
+		}
+	}
+	for path, methods := range operations {
+		doc.Paths[path] = make(map[string]openAPIOperation)
+		for method, actions := range methods {
+			doc.Paths[path][method] = actions.operation()
+		}
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal OpenAPI document: %v", err)
+	}
+	return data, nil
+}
+
+// openAPIActions holds the actions merged into an OpenAPI operation.
+type openAPIActions struct {
+	// handler is the first handler with any of the actions.
+	handler *APIHandler
+	actions []APIAction
+	// anon and auth are set when any action is of an anonymous or
+	// authenticated handler.
+	anon, auth bool
+	// restful and withOp are set when any action has no op, or has one.
+	restful, withOp bool
+}
+
+// add adds action of an anonymous or authenticated handler, unless an
+// action with the same op was already added.
+func (o *openAPIActions) add(action APIAction, anon bool) {
+	if anon {
+		o.anon = true
+	} else {
+		o.auth = true
+	}
+	for _, existing := range o.actions {
+		if actionOp(existing) == actionOp(action) {
+			return
+		}
+	}
+	if action.Op == nil {
+		o.restful = true
+	} else {
+		o.withOp = true
+	}
+	o.actions = append(o.actions, action)
+}
+
+// actionOp returns the op of action, or "" when it has none.
+func actionOp(action APIAction) string {
+	if action.Op == nil {
+		return ""
+	}
+	return *action.Op
+}
+
+// describe returns text, naming the op of action it applies to when o
+// has more than one action.
+func (o *openAPIActions) describe(action APIAction, text string) string {
+	if len(o.actions) == 1 {
+		return text
+	}
+	if op := actionOp(action); op != "" {
+		return fmt.Sprintf("op=%s: %s", op, text)
+	}
+	return fmt.Sprintf("%s (no op): %s", action.Name, text)
+}
+
+// operation returns the OpenAPI operation calling the actions of o.
+func (o *openAPIActions) operation() openAPIOperation {
+	name := strings.TrimSuffix(o.handler.Name, "Handler")
+	op := openAPIOperation{
+		Tags:      []string{strings.TrimPrefix(name, "Anon")},
+		Responses: make(map[string]openAPIResponse),
+		Security:  []map[string][]string{{openAPISecurityScheme: {}}},
+	}
+	switch {
+	case !o.auth:
+		op.Security = []map[string][]string{}
+	case o.anon:
+		op.Security = append([]map[string][]string{{}}, op.Security...)
+	}
+
+	if len(o.actions) == 1 {
+		action := o.actions[0]
+		op.OperationID = exportedName(name) + exportedName(action.Name)
+		if parts := strings.SplitN(action.Doc, "\n\n", 2); parts[0] != "" {
+			op.Summary = strings.TrimSpace(parts[0])
+			if len(parts) == 2 {
+				op.Description = strings.TrimSpace(parts[1])
+			}
+		}
+	} else {
+		method := strings.ToUpper(o.actions[0].Method)
+		op.OperationID = exportedName(name) + exportedName(strings.ToLower(method))
+		op.Summary = fmt.Sprintf("%s actions of %s, selected by op.", method, o.handler.Name)
+		var lines []string
+		for _, action := range o.actions {
+			summary := strings.TrimSpace(strings.SplitN(action.Doc, "\n\n", 2)[0])
+			lines = append(lines, "- "+o.describe(action, summary))
+		}
+		op.Description = strings.Join(lines, "\n")
+	}
+
+	for _, param := range o.handler.Params {
+		op.Parameters = append(op.Parameters, openAPIParameter{
+			Name:     param,
+			In:       "path",
+			Required: true,
+			Schema:   openAPISchema{Type: "string"},
+		})
+	}
+	if o.withOp {
+		opParam := openAPIParameter{
+			Name:     "op",
+			In:       "query",
+			Required: !o.restful,
+			Schema:   openAPISchema{Type: "string"},
+		}
+		for _, action := range o.actions {
+			if action.Op != nil {
+				opParam.Schema.Enum = append(opParam.Schema.Enum, *action.Op)
+			} else {
+				opParam.Description = fmt.Sprintf("The action to call; %s without it.", action.Name)
+			}
+		}
+		op.Parameters = append(op.Parameters, opParam)
+	}
+
+	// Params of several actions are described by the first one.
+	form := openAPISchema{Type: "object", Properties: make(map[string]openAPISchema)}
+	seen := make(map[string]bool)
+	inQuery := o.actions[0].Method == "GET" || o.actions[0].Method == "DELETE"
+	for _, action := range o.actions {
+		for _, name := range action.paramNames() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			param := action.DocParams[name]
+			schema := openAPISchemaOf(param.GoType)
+			description := o.describe(action, param.Doc)
+			if inQuery {
+				op.Parameters = append(op.Parameters, openAPIParameter{
+					Name:        name,
+					In:          "query",
+					Description: description,
+					Schema:      schema,
+				})
+				continue
+			}
+			schema.Description = description
+			form.Properties[name] = schema
+		}
+	}
+	if len(form.Properties) > 0 {
+		op.RequestBody = &openAPIRequestBody{Content: map[string]openAPIMediaType{
+			"application/x-www-form-urlencoded": {Schema: form},
+		}}
+	}
+
+	success := false
+	for _, action := range o.actions {
+		for _, code := range action.sortedCodes() {
+			description := o.describe(action, strings.Join(action.DocReturns[code], " "))
+			key := strconv.Itoa(code)
+			if existing, ok := op.Responses[key]; ok {
+				description = existing.Description + "\n" + description
+			}
+			response := openAPIResponse{Description: description}
+			if code >= 200 && code < 300 {
+				success = true
+				response.Content = openAPIJSONContent()
+			}
+			op.Responses[key] = response
+		}
+	}
+	if !success {
+		op.Responses["200"] = openAPIResponse{Description: "Success.", Content: openAPIJSONContent()}
+	}
+	return op
+}
+
+// openAPIJSONContent returns the content of successful responses, which
+// can be any JSON value.
+func openAPIJSONContent() map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{"application/json": {}}
+}
+
+// openAPISchemaOf returns the schema of values of the given type, as
+// derived by deriveGoTypeFromPythonType.
+func openAPISchemaOf(goType reflect.Type) openAPISchema {
+	switch {
+	case goType == reflect.TypeOf(net.IP{}):
+		return openAPISchema{Type: "string", Format: "ip"}
+	case goType == reflect.SliceOf(reflect.TypeOf("")):
+		return openAPISchema{Type: "array", Items: &openAPISchema{Type: "string"}}
+	case goType == nil:
+		return openAPISchema{Type: "string"}
+	}
+	switch goType.Kind() {
+	case reflect.Bool:
+		return openAPISchema{Type: "boolean"}
+	case reflect.Int:
+		return openAPISchema{Type: "integer"}
+	case reflect.Float64:
+		return openAPISchema{Type: "number"}
+	case reflect.Struct:
+		if goType.Name() == "object" {
+			return openAPISchema{Type: "object"}
+		}
+	}
+	return openAPISchema{Type: "string"}
+}
@@ -0,0 +1,88 @@
+package maas
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// TestOpenAPIValid validates the OpenAPI document of a synthetic API
+// description, covering more handlers than maastest implements. It is
+// modelled on the MAAS 1.9 handler docs, but was not captured from a MAAS
+// server.
+func TestOpenAPIValid(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/synthetic-describe.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiDesc, _, err := ParseAPIDescription(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = apiDesc.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		t.Fatalf("cannot load OpenAPI document: %v", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+
+	for path := range doc.Paths.Map() {
+		if strings.ContainsAny(path, "?#") {
+			t.Errorf("path %q has a query or fragment", path)
+		}
+	}
+	for _, test := range []struct {
+		about, path, method string
+		ops                 []string
+		required            bool
+		description         string
+	}{{
+		about:    "ops only",
+		path:     "/ipaddresses/",
+		method:   "POST",
+		ops:      []string{"release", "reserve"},
+		required: true,
+	}, {
+		about:       "ops of a restful action",
+		path:        "/files/",
+		method:      "GET",
+		ops:         []string{"get", "get_by_key"},
+		description: "The action to call; read without it.",
+	}, {
+		about:  "ops of anonymous and authenticated handlers",
+		path:   "/nodes/",
+		method: "POST",
+		ops: []string{
+			"new", "accept", "accept_all", "release", "check_commissioning",
+			"acquire", "set_zone",
+		},
+		required: true,
+	}} {
+		op := doc.Paths.Find(test.path).GetOperation(test.method)
+		if op == nil {
+			t.Errorf("%s: no %s %s operation", test.about, test.method, test.path)
+			continue
+		}
+		param := op.Parameters.GetByInAndName("query", "op")
+		if param == nil {
+			t.Errorf("%s: no op parameter", test.about)
+			continue
+		}
+		var ops []string
+		for _, op := range param.Schema.Value.Enum {
+			ops = append(ops, op.(string))
+		}
+		if !reflect.DeepEqual(ops, test.ops) || param.Required != test.required || param.Description != test.description {
+			t.Errorf("%s: unexpected op parameter: %+v (enum %v)", test.about, param, ops)
+		}
+	}
+}
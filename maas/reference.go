@@ -0,0 +1,219 @@
+package maas
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// reference holds the API description in the form rendered by Markdown
+// and HTML.
+type reference struct {
+	Doc       string
+	Hash      string
+	Resources []referenceResource
+}
+
+type referenceResource struct {
+	Name     string
+	Anchor   string
+	Handlers []referenceHandler
+}
+
+type referenceHandler struct {
+	Name    string
+	Doc     string
+	Path    string
+	Anon    bool
+	Params  []string
+	Actions []referenceAction
+}
+
+type referenceAction struct {
+	Name    string
+	Anon    bool
+	Anchor  string
+	Method  string
+	Call    string
+	Doc     string
+	Params  []ActionParam
+	Returns []referenceReturn
+}
+
+type referenceReturn struct {
+	Code int
+	Doc  string
+}
+
+// reference returns the reference of the API, with resources sorted by
+// name, and params and return codes of each action in order.
+func (a *APIDescription) reference() reference {
+	ref := reference{Doc: a.Doc, Hash: a.Hash}
+	for _, resource := range a.Resources {
+		refResource := referenceResource{Name: resource.Name, Anchor: anchor(resource.Name)}
+		for _, handler := range []*APIHandler{resource.Auth, resource.Anon} {
+			if handler == nil {
+				continue
+			}
+			refHandler := referenceHandler{
+				Name:   handler.Name,
+				Doc:    handler.Doc,
+				Path:   handler.Path,
+				Anon:   handler == resource.Anon,
+				Params: handler.Params,
+			}
+			for _, action := range handler.Actions {
+				refAction := referenceAction{
+					Name:   action.Name,
+					Anon:   refHandler.Anon,
+					Anchor: anchor(handler.Name, action.Name),
+					Method: action.Method,
+					Call:   referenceCall(handler, action),
+					Doc:    action.Doc,
+				}
+				for _, name := range action.paramNames() {
+					refAction.Params = append(refAction.Params, action.DocParams[name])
+				}
+				for _, code := range action.sortedCodes() {
+					for _, doc := range action.DocReturns[code] {
+						refAction.Returns = append(refAction.Returns, referenceReturn{Code: code, Doc: doc})
+					}
+				}
+				refHandler.Actions = append(refHandler.Actions, refAction)
+			}
+			refResource.Handlers = append(refResource.Handlers, refHandler)
+		}
+		ref.Resources = append(ref.Resources, refResource)
+	}
+	sort.Slice(ref.Resources, func(i, j int) bool {
+		return ref.Resources[i].Name < ref.Resources[j].Name
+	})
+	return ref
+}
+
+// referenceCall returns the path of action of handler, relative to the API
+// version prefix, with its op (if any) appended, e.g.
+// "/ipaddresses/?op=reserve".
+func referenceCall(handler *APIHandler, action APIAction) string {
+	call := "/" + relativePath(handler.Path)
+	if action.Op != nil {
+		call += "?op=" + *action.Op
+	}
+	return call
+}
+
+// anchor returns the anchor of a section of the reference, given the
+// names identifying it.
+func anchor(names ...string) string {
+	return strings.ToLower(strings.Join(names, "-"))
+}
+
+// markdownCell escapes s for use in a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.NewReplacer("|", `\|`, "<", "&lt;", ">", "&gt;").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+var referenceFuncs = map[string]interface{}{
+	"cell": markdownCell,
+	"join": strings.Join,
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Funcs(referenceFuncs).Parse(`# MAAS API reference
+
+{{.Doc}} (API version ` + APIVersion + `{{if .Hash}}, hash ` + "`{{.Hash}}`" + `{{end}}).
+
+{{range .Resources}}- [{{.Name}}](#{{.Anchor}})
+{{range .Handlers}}{{range .Actions}}  - [{{.Name}}{{if .Anon}} (anonymous){{end}}](#{{.Anchor}})
+{{end}}{{end}}{{end}}{{range .Resources}}
+<a id="{{.Anchor}}"></a>
+## {{.Name}}
+{{range .Handlers}}
+### {{.Name}}{{if .Anon}} (anonymous){{end}}
+
+{{.Doc}}
+
+Path: ` + "`{{.Path}}`" + `{{if .Params}} (params: {{join .Params ", "}}){{end}}
+{{range .Actions}}
+<a id="{{.Anchor}}"></a>
+#### {{.Name}}
+
+` + "`{{.Method}} {{.Call}}`" + `
+{{if .Doc}}
+{{.Doc}}
+{{end}}{{if .Params}}
+| Param | Type | Go type | Description |
+|-------|------|---------|-------------|
+{{range .Params}}| {{.Name}} | {{cell .PythonType}} | {{cell (printf "%v" .GoType)}} | {{cell .Doc}} |
+{{end}}{{end}}{{if .Returns}}
+Returns:
+{{range .Returns}}
+- **{{.Code}}** {{.Doc}}{{end}}
+{{end}}{{end}}{{end}}{{end}}`))
+
+// Markdown returns a reference of the API in Markdown, grouped by
+// resource, with an anchor for each action, a table of its params and its
+// return codes.
+func (a *APIDescription) Markdown() (string, error) {
+	var out bytes.Buffer
+	if err := markdownTemplate.Execute(&out, a.reference()); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(referenceFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MAAS API reference</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+code, pre { background: #f4f4f4; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>MAAS API reference</h1>
+<p>{{.Doc}} (API version ` + APIVersion + `{{if .Hash}}, hash <code>{{.Hash}}</code>{{end}}).</p>
+<ul>
+{{range .Resources}}<li><a href="#{{.Anchor}}">{{.Name}}</a>
+<ul>
+{{range .Handlers}}{{range .Actions}}<li><a href="#{{.Anchor}}">{{.Name}}{{if .Anon}} (anonymous){{end}}</a></li>
+{{end}}{{end}}</ul>
+</li>
+{{end}}</ul>
+{{range .Resources}}
+<h2 id="{{.Anchor}}">{{.Name}}</h2>
+{{range .Handlers}}
+<h3>{{.Name}}{{if .Anon}} (anonymous){{end}}</h3>
+<p>{{.Doc}}</p>
+<p>Path: <code>{{.Path}}</code>{{if .Params}} (params: {{join .Params ", "}}){{end}}</p>
+{{range .Actions}}
+<h4 id="{{.Anchor}}">{{.Name}}</h4>
+<p><code>{{.Method}} {{.Call}}</code></p>
+{{if .Doc}}<pre>{{.Doc}}</pre>
+{{end}}{{if .Params}}<table>
+<tr><th>Param</th><th>Type</th><th>Go type</th><th>Description</th></tr>
+{{range .Params}}<tr><td>{{.Name}}</td><td>{{.PythonType}}</td><td>{{printf "%v" .GoType}}</td><td>{{.Doc}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Returns}}<p>Returns:</p>
+<ul>
+{{range .Returns}}<li><b>{{.Code}}</b> {{.Doc}}</li>
+{{end}}</ul>
+{{end}}{{end}}{{end}}{{end}}</body>
+</html>
+`))
+
+// HTML returns the reference returned by Markdown as a standalone HTML
+// page.
+func (a *APIDescription) HTML() (string, error) {
+	var out bytes.Buffer
+	if err := htmlTemplate.Execute(&out, a.reference()); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,99 @@
+package maas
+
+import (
+	"strings"
+)
+
+// APIFilter selects actions of an API description. Empty fields match any
+// action.
+type APIFilter struct {
+	// Search matches actions when found (case-insensitively) in their
+	// name, op, doc or the names and docs of their params, or in the name
+	// or path of their handler.
+	Search string
+	// Method matches actions with the given HTTP method (e.g. POST).
+	Method string
+	// Resource matches the actions of handlers with the given name, with
+	// or without the "Handler" suffix (e.g. "IPAddresses"), or with a path
+	// (relative to the API version prefix) at or below the given one (e.g.
+	// "nodes" matches "nodes/" and "nodes/{system_id}/").
+	Resource string
+}
+
+// IsEmpty returns whether f matches any action.
+func (f APIFilter) IsEmpty() bool {
+	return f == APIFilter{}
+}
+
+// Filter returns a copy of a with only the actions matching filter, and
+// the handlers and resources having any of them.
+func (a *APIDescription) Filter(filter APIFilter) *APIDescription {
+	filtered := &APIDescription{Doc: a.Doc, Hash: a.Hash}
+	for _, resource := range a.Resources {
+		anon, auth := filter.handler(resource.Anon), filter.handler(resource.Auth)
+		if anon == nil && auth == nil {
+			continue
+		}
+		filtered.Resources = append(filtered.Resources, APIResource{Name: resource.Name, Anon: anon, Auth: auth})
+	}
+	return filtered
+}
+
+// handler returns a copy of handler with only the actions matching f, or
+// nil when there are none.
+func (f APIFilter) handler(handler *APIHandler) *APIHandler {
+	if handler == nil || !f.matchesResource(handler) {
+		return nil
+	}
+	term := strings.ToLower(f.Search)
+	handlerMatches := strings.Contains(strings.ToLower(handler.Name), term) ||
+		strings.Contains(strings.ToLower(relativePath(handler.Path)), term)
+
+	var actions []APIAction
+	for _, action := range handler.Actions {
+		if f.Method != "" && !strings.EqualFold(action.Method, f.Method) {
+			continue
+		}
+		if handlerMatches || action.contains(term) {
+			actions = append(actions, action)
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+	copied := *handler
+	copied.Actions = actions
+	return &copied
+}
+
+// matchesResource returns whether handler matches f.Resource.
+func (f APIFilter) matchesResource(handler *APIHandler) bool {
+	if f.Resource == "" {
+		return true
+	}
+	name := strings.ToLower(strings.TrimSuffix(f.Resource, "Handler"))
+	if strings.ToLower(strings.TrimSuffix(handler.Name, "Handler")) == name {
+		return true
+	}
+	path := strings.Trim(f.Resource, "/")
+	handlerPath := strings.Trim(relativePath(handler.Path), "/")
+	return handlerPath == path || strings.HasPrefix(handlerPath, path+"/")
+}
+
+// contains returns whether the lowercase term is found in the name, op or
+// doc of a, or in the names and docs of its params.
+func (a APIAction) contains(term string) bool {
+	texts := []string{a.Name, a.Doc}
+	if a.Op != nil {
+		texts = append(texts, *a.Op)
+	}
+	for name, param := range a.DocParams {
+		texts = append(texts, name, param.Doc)
+	}
+	for _, text := range texts {
+		if strings.Contains(strings.ToLower(text), term) {
+			return true
+		}
+	}
+	return false
+}
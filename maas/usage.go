@@ -0,0 +1,84 @@
+package maas
+
+import (
+	"math/big"
+	"net"
+)
+
+// PoolUsage describes how much of the static IP pool of a network is used.
+// The pool is the static range of the node group interface matching the
+// network (see MatchNIC).
+type PoolUsage struct {
+	Network   string
+	ClusterID string
+	Interface string
+	// StaticSize is the number of addresses in the static range.
+	StaticSize *big.Int
+	// Allocated holds the number of static IPs within the network, keyed
+	// by allocation type name.
+	Allocated map[string]int
+	// Free is the number of unallocated addresses in the static range.
+	Free *big.Int
+	// DHCPSize is the number of addresses in the DHCP range.
+	DHCPSize *big.Int
+	// Utilization is the percentage of the static range allocated.
+	Utilization float64
+}
+
+// HasStaticRange returns whether the usage covers a static range.
+func (u *PoolUsage) HasStaticRange() bool {
+	return u.StaticSize.Sign() > 0
+}
+
+// NetworkUsage returns the usage of the static IP pool of nw, given the
+// interfaces of all node groups and all allocated static IPs. When no
+// interface matches nw, or it has no static range, only Allocated is set.
+func NetworkUsage(nw Network, nics []Interface, ips []StaticIP) (PoolUsage, error) {
+	usage := PoolUsage{
+		Network:    nw.Name,
+		StaticSize: new(big.Int),
+		Allocated:  make(map[string]int),
+		Free:       new(big.Int),
+		DHCPSize:   new(big.Int),
+	}
+	ipNet, err := nw.IPNet()
+	if err != nil {
+		return PoolUsage{}, err
+	}
+	for _, ip := range ips {
+		if ipNet.Contains(ip.IP.IP) {
+			usage.Allocated[ip.AllocType.String()]++
+		}
+	}
+	nic, ok := matchNIC(ipNet, nics)
+	if !ok {
+		return usage, nil
+	}
+	usage.ClusterID, usage.Interface = nic.ClusterID, nic.Name
+	if !nic.DHCPRangeLowIP.IsEmpty() && !nic.DHCPRangeHighIP.IsEmpty() {
+		if usage.DHCPSize, err = IPRangeSize(nic.DHCPRangeLowIP.IP, nic.DHCPRangeHighIP.IP); err != nil {
+			return PoolUsage{}, err
+		}
+	}
+	if !nic.HasStaticRange() {
+		return usage, nil
+	}
+	if usage.StaticSize, err = IPRangeSize(nic.StaticRangeLowIP.IP, nic.StaticRangeHighIP.IP); err != nil {
+		return PoolUsage{}, err
+	}
+	allocated := make([]net.IP, len(ips))
+	for i, ip := range ips {
+		allocated[i] = ip.IP.IP
+	}
+	free, err := FreeRanges(nic.StaticRangeLowIP.IP, nic.StaticRangeHighIP.IP, allocated)
+	if err != nil {
+		return PoolUsage{}, err
+	}
+	for _, r := range free {
+		usage.Free.Add(usage.Free, r.Size())
+	}
+	used := new(big.Int).Sub(usage.StaticSize, usage.Free)
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(used), new(big.Float).SetInt(usage.StaticSize)).Float64()
+	usage.Utilization = ratio * 100
+	return usage, nil
+}
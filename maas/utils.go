@@ -1,4 +1,4 @@
-package main
+package maas
 
 import (
 	"fmt"
@@ -6,6 +6,8 @@ import (
 	"time"
 )
 
+// FieldsMap holds the decoded JSON fields of a MAAS API object and
+// provides typed accessors for them.
 type FieldsMap map[string]interface{}
 
 func (m FieldsMap) StringField(name string, optional bool) (string, error) {
@@ -66,10 +68,13 @@ func (m FieldsMap) NetmaskField(name string, optional bool) (net.IPMask, error)
 	if err != nil {
 		return nothing, err
 	}
-	if mask == "" && !optional {
-		return nothing, fmt.Errorf("required field %q is empty", name)
+	if mask == "" {
+		if !optional {
+			return nothing, fmt.Errorf("required field %q is empty", name)
+		}
+		return nothing, nil
 	}
-	return ParseIPv4Mask(mask)
+	return ParseMask(mask)
 }
 
 func (m FieldsMap) TimeField(name string, optional bool) (time.Time, error) {
@@ -84,5 +89,9 @@ func (m FieldsMap) TimeField(name string, optional bool) (time.Time, error) {
 		}
 		return nothing, nil
 	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	// MAAS returns UTC times without a zone.
 	return time.Parse(time.RFC3339, val+"Z")
 }
@@ -0,0 +1,116 @@
+package maas
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"time"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	IPAdded        EventType = "ip-added"
+	IPRemoved      EventType = "ip-removed"
+	NetworkAdded   EventType = "network-added"
+	NetworkRemoved EventType = "network-removed"
+)
+
+// Event describes a static IP or network added or removed between two
+// snapshots.
+type Event struct {
+	Time    time.Time `json:"time" yaml:"time"`
+	Type    EventType `json:"type" yaml:"type"`
+	IP      *StaticIP `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Network *Network  `json:"network,omitempty" yaml:"network,omitempty"`
+}
+
+// Snapshot holds the static IPs (keyed by address) and networks (keyed by
+// name) at some point in time.
+type Snapshot struct {
+	Time     time.Time
+	IPs      map[string]StaticIP
+	Networks map[string]Network
+}
+
+// Snapshot returns the current static IPs and networks.
+func (c *Client) Snapshot() (Snapshot, error) {
+	networks, err := c.GetNetworks()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	ips, err := c.GetIPs()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot := Snapshot{
+		Time:     time.Now(),
+		IPs:      make(map[string]StaticIP, len(ips)),
+		Networks: networks,
+	}
+	for _, ip := range ips {
+		snapshot.IPs[ip.IP.String()] = ip
+	}
+	return snapshot, nil
+}
+
+// DiffSnapshots returns the events between the old and new snapshots, at
+// the time of the new one: removed networks, added networks, removed IPs,
+// then added IPs, each sorted by name or address.
+func DiffSnapshots(old, new Snapshot) []Event {
+	var events []Event
+	for _, name := range missingKeys(networkKeys(new.Networks), networkKeys(old.Networks)) {
+		nw := old.Networks[name]
+		events = append(events, Event{Time: new.Time, Type: NetworkRemoved, Network: &nw})
+	}
+	for _, name := range missingKeys(networkKeys(old.Networks), networkKeys(new.Networks)) {
+		nw := new.Networks[name]
+		events = append(events, Event{Time: new.Time, Type: NetworkAdded, Network: &nw})
+	}
+	for _, addr := range sortIPs(missingKeys(ipKeys(new.IPs), ipKeys(old.IPs))) {
+		ip := old.IPs[addr]
+		events = append(events, Event{Time: new.Time, Type: IPRemoved, IP: &ip})
+	}
+	for _, addr := range sortIPs(missingKeys(ipKeys(old.IPs), ipKeys(new.IPs))) {
+		ip := new.IPs[addr]
+		events = append(events, Event{Time: new.Time, Type: IPAdded, IP: &ip})
+	}
+	return events
+}
+
+func networkKeys(networks map[string]Network) map[string]bool {
+	keys := make(map[string]bool, len(networks))
+	for name := range networks {
+		keys[name] = true
+	}
+	return keys
+}
+
+func ipKeys(ips map[string]StaticIP) map[string]bool {
+	keys := make(map[string]bool, len(ips))
+	for addr := range ips {
+		keys[addr] = true
+	}
+	return keys
+}
+
+// missingKeys returns the keys of others missing from keys, sorted.
+func missingKeys(keys, others map[string]bool) []string {
+	var missing []string
+	for key := range others {
+		if !keys[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// sortIPs sorts the given addresses numerically, rather than as strings.
+func sortIPs(addrs []string) []string {
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(addrs[i]).To16(), net.ParseIP(addrs[j]).To16()) < 0
+	})
+	return addrs
+}
@@ -0,0 +1,92 @@
+package maas
+
+import (
+	"fmt"
+	"net"
+)
+
+// Ranges of a node group interface an address can fall in.
+const (
+	RangeStatic = "static"
+	RangeDHCP   = "dhcp"
+	RangeNone   = "none"
+)
+
+// IPInfo describes how an IP address is used in MAAS.
+type IPInfo struct {
+	IP net.IP `json:"ip" yaml:"ip"`
+	// Network is the most specific network containing IP, if any.
+	Network *Network `json:"network" yaml:"network"`
+	// Interface is the node group interface with a subnet containing IP,
+	// if any.
+	Interface *Interface `json:"interface" yaml:"interface"`
+	// Range is the range of Interface containing IP: RangeStatic,
+	// RangeDHCP or RangeNone.
+	Range string `json:"range" yaml:"range"`
+	// Allocation is the static IP allocated for IP, if any.
+	Allocation *StaticIP `json:"allocation" yaml:"allocation"`
+}
+
+// WhoisIP returns how ip is used, given all networks, the interfaces of
+// all node groups and all allocated static IPs.
+func WhoisIP(ip net.IP, networks map[string]Network, nics []Interface, ips []StaticIP) (IPInfo, error) {
+	info := IPInfo{IP: ip, Range: RangeNone}
+	bestPrefix := -1
+	for name := range networks {
+		nw := networks[name]
+		ipNet, err := nw.IPNet()
+		if err != nil {
+			return IPInfo{}, err
+		}
+		ones, _ := ipNet.Mask.Size()
+		if !ipNet.Contains(ip) || ones < bestPrefix {
+			continue
+		}
+		if ones == bestPrefix && info.Network.Name < name {
+			// Keep the result stable for overlapping networks.
+			continue
+		}
+		info.Network, bestPrefix = &nw, ones
+	}
+
+	for i := range nics {
+		nic := nics[i]
+		ipNet, err := nic.IPNet()
+		if err != nil || !ipNet.Contains(ip) {
+			continue
+		}
+		info.Interface = &nic
+		inStatic, err := inAddressRange(ip, nic.StaticRangeLowIP, nic.StaticRangeHighIP)
+		if err != nil {
+			return IPInfo{}, fmt.Errorf("invalid static range of interface %q: %v", nic.Name, err)
+		}
+		inDHCP, err := inAddressRange(ip, nic.DHCPRangeLowIP, nic.DHCPRangeHighIP)
+		if err != nil {
+			return IPInfo{}, fmt.Errorf("invalid DHCP range of interface %q: %v", nic.Name, err)
+		}
+		switch {
+		case inStatic:
+			info.Range = RangeStatic
+		case inDHCP:
+			info.Range = RangeDHCP
+		}
+		break
+	}
+
+	for i := range ips {
+		if ips[i].IP.IP.Equal(ip) {
+			info.Allocation = &ips[i]
+			break
+		}
+	}
+	return info, nil
+}
+
+// inAddressRange returns whether ip is between low and high, inclusive.
+// The range is empty if either bound is.
+func inAddressRange(ip net.IP, low, high Address) (bool, error) {
+	if low.IsEmpty() || high.IsEmpty() {
+		return false, nil
+	}
+	return IPInRange(ip, low.IP, high.IP)
+}